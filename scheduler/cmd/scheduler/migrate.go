@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/config"
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/database"
+	log "github.com/sirupsen/logrus"
+)
+
+const migrateUsage = `usage: scheduler migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    revert the last n applied migrations (default 1)
+  status      list migrations and whether they are applied`
+
+// runMigrate implements the migrate subcommand and returns the exit code.
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	steps := 1
+	switch args[0] {
+	case "up", "status":
+		if len(args) > 1 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+	case "down":
+		if len(args) > 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "invalid number of migrations %q\n", args[1])
+				return 2
+			}
+			steps = n
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		log.Errorf("Failed to connect to database: %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp()
+		if err != nil {
+			log.Errorf("Failed to run migrations: %v", err)
+			return 1
+		}
+		log.Infof("Applied %d migration(s)", applied)
+	case "down":
+		reverted, err := db.MigrateDown(steps)
+		if err != nil {
+			log.Errorf("Failed to revert migrations (%d reverted): %v", reverted, err)
+			return 1
+		}
+		log.Infof("Reverted %d migration(s)", reverted)
+	case "status":
+		states, err := db.MigrationStatus()
+		if err != nil {
+			log.Errorf("Failed to read migration status: %v", err)
+			return 1
+		}
+		printMigrationStatus(states)
+	}
+	return 0
+}
+
+func printMigrationStatus(states []database.MigrationState) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, state := range states {
+		status, appliedAt := "pending", ""
+		if state.AppliedAt != nil {
+			status, appliedAt = "applied", state.AppliedAt.Format(time.RFC3339)
+		}
+		switch {
+		case state.Unknown:
+			status = "unknown"
+		case state.Modified:
+			status = "modified"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", state.Version, state.Name, status, appliedAt)
+	}
+	w.Flush()
+}
+
+// checkSchema is used instead of migrating at startup when
+// database.skip_migrations is set: the scheduler only runs against a schema
+// that is fully migrated.
+func checkSchema(db *database.DB) error {
+	states, err := db.MigrationStatus()
+	if err != nil {
+		return fmt.Errorf("failed to read migration status: %w", err)
+	}
+
+	pending := 0
+	for _, state := range states {
+		if state.Modified {
+			return fmt.Errorf("migration %04d_%s was modified after it was applied", state.Version, state.Name)
+		}
+		if state.AppliedAt == nil {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("database schema is behind by %d migration(s); run `scheduler migrate up`", pending)
+	}
+	return nil
+}
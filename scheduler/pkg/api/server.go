@@ -1,11 +1,21 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -46,8 +56,38 @@ func (s *Server) setupRoutes() {
 	api.HandleFunc("/schedule", s.createSchedule).Methods("POST")
 	api.HandleFunc("/schedule", s.listSchedules).Methods("GET")
 	api.HandleFunc("/schedule/{id}", s.getSchedule).Methods("GET")
+	api.HandleFunc("/schedule/{id}", s.updateSchedule).Methods("PATCH")
 	api.HandleFunc("/schedule/{id}", s.cancelSchedule).Methods("DELETE")
 	api.HandleFunc("/schedule/{id}/execute", s.executeSchedule).Methods("POST")
+	api.HandleFunc("/schedule/{id}/attempts", s.listScheduleAttempts).Methods("GET")
+	api.HandleFunc("/schedule/{id}/edits", s.listScheduleEdits).Methods("GET")
+	api.HandleFunc("/schedule/{id}/replay", s.replaySchedule).Methods("POST")
+	api.HandleFunc("/change-requests/{id}/attempts", s.listChangeRequestAttempts).Methods("GET")
+	api.HandleFunc("/dead-letter", s.listDeadLetters).Methods("GET")
+	api.HandleFunc("/dead-letter/replay", s.replayDeadLetters).Methods("POST")
+	api.HandleFunc("/plans", s.createPlan).Methods("POST")
+	api.HandleFunc("/plans/{id}", s.getPlan).Methods("GET")
+	api.HandleFunc("/plans/{id}", s.cancelPlan).Methods("DELETE")
+	api.HandleFunc("/plans/{id}/retry", s.retryPlan).Methods("POST")
+	api.HandleFunc("/batches", s.createBatch).Methods("POST")
+	api.HandleFunc("/batches/{id}", s.getBatch).Methods("GET")
+	api.HandleFunc("/batches/{id}", s.cancelBatch).Methods("DELETE")
+	api.HandleFunc("/batches/{id}/replay", s.replayBatch).Methods("POST")
+	api.HandleFunc("/templates", s.createTemplate).Methods("POST")
+	api.HandleFunc("/templates", s.listTemplates).Methods("GET")
+	api.HandleFunc("/templates/{name}", s.getTemplate).Methods("GET")
+	api.HandleFunc("/templates/{name}/versions", s.listTemplateVersions).Methods("GET")
+	api.HandleFunc("/templates/{name}/render", s.renderTemplate).Methods("POST")
+	api.HandleFunc("/recurring", s.createRecurring).Methods("POST")
+	api.HandleFunc("/recurring", s.listRecurring).Methods("GET")
+	api.HandleFunc("/recurring/{id}", s.getRecurring).Methods("GET")
+	api.HandleFunc("/recurring/{id}", s.deleteRecurring).Methods("DELETE")
+	api.HandleFunc("/recurring/{id}/pause", s.pauseRecurring).Methods("POST")
+	api.HandleFunc("/recurring/{id}/resume", s.resumeRecurring).Methods("POST")
+	api.HandleFunc("/scheduler/stats", s.schedulerStats).Methods("GET")
+	api.HandleFunc("/callbacks/{token}", s.receiveCallback).Methods("POST")
+	api.HandleFunc("/admin/pause", s.pauseExecution).Methods("POST")
+	api.HandleFunc("/admin/resume", s.resumeExecution).Methods("POST")
 
 	// Health check
 	s.router.HandleFunc("/health", s.healthCheck).Methods("GET")
@@ -75,68 +115,227 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return s.server.Shutdown(ctx)
 }
 
+// scheduleRequest is the body of POST /api/schedule
+type scheduleRequest struct {
+	JobType         string          `json:"job_type"`
+	Payload         json.RawMessage `json:"payload"`
+	ScheduleTime    string          `json:"schedule_time"`
+	Timezone        string          `json:"timezone,omitempty"`
+	Tags            []string        `json:"tags"`
+	TargetUserEmail *string         `json:"target_user_email,omitempty"`
+	RequestedBy     *string         `json:"requested_by,omitempty"`
+	ApprovalStatus  string          `json:"approval_status,omitempty"`
+	IdempotencyKey  string          `json:"idempotency_key,omitempty"`
+	DryRun          bool            `json:"dry_run,omitempty"`
+	DependsOn       []uuid.UUID     `json:"depends_on,omitempty"`
+	Priority        *int            `json:"priority,omitempty"` // defaults to the job type's priority
+
+	// Template renders the payload from a stored template instead of
+	// taking it verbatim. TemplateVersion defaults to the latest.
+	Template        string                 `json:"template,omitempty"`
+	TemplateVersion int                    `json:"template_version,omitempty"`
+	Params          map[string]interface{} `json:"params,omitempty"`
+}
+
+// errTemplateLookup is returned by newJob when a template could not be
+// loaded because of a server-side failure rather than a bad request.
+var errTemplateLookup = errors.New("failed to load template")
+
 // createSchedule creates a new scheduled job
 func (s *Server) createSchedule(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		JobType         string          `json:"job_type"`
-		Payload         json.RawMessage `json:"payload"`
-		ScheduleTime    time.Time       `json:"schedule_time"`
-		Tags            []string        `json:"tags"`
-		TargetUserEmail *string         `json:"target_user_email,omitempty"`
-		RequestedBy     *string         `json:"requested_by,omitempty"`
-		ApprovalStatus  string          `json:"approval_status,omitempty"`
-	}
+	var req scheduleRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	// Validate job type
-	if !database.ValidJobTypes[req.JobType] {
-		respondError(w, http.StatusBadRequest, "Invalid job_type")
+	// Resolve the idempotency key before validating, so a retry of a request
+	// that was accepted earlier still returns the original job even if e.g.
+	// its schedule_time has since passed.
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if idempotencyKey != "" && req.IdempotencyKey != "" && idempotencyKey != req.IdempotencyKey {
+		respondError(w, http.StatusBadRequest, "Idempotency-Key header and idempotency_key field differ")
 		return
 	}
+	if idempotencyKey == "" {
+		idempotencyKey = req.IdempotencyKey
+	}
 
-	// Validate payload
-	if len(req.Payload) == 0 {
-		respondError(w, http.StatusBadRequest, "payload is required")
-		return
+	var requestHash string
+	if idempotencyKey != "" {
+		hash, err := hashScheduleRequest(req)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		requestHash = hash
+
+		if s.replayIdempotentRequest(w, idempotencyKey, requestHash) {
+			return
+		}
 	}
 
-	// Validate schedule time
-	if req.ScheduleTime.IsZero() {
-		respondError(w, http.StatusBadRequest, "schedule_time is required")
+	job, err := s.newJob(req)
+	if errors.Is(err, errTemplateLookup) {
+		respondError(w, http.StatusInternalServerError, "Failed to load template")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if idempotencyKey != "" {
+		job.IdempotencyKey = &idempotencyKey
+		job.RequestHash = &requestHash
+	}
 
-	if req.ScheduleTime.Before(time.Now()) {
-		respondError(w, http.StatusBadRequest, "schedule_time must be in the future")
+	if err := s.db.CreateScheduledJob(job); err != nil {
+		if errors.Is(err, database.ErrDuplicateIdempotencyKey) &&
+			s.replayIdempotentRequest(w, idempotencyKey, requestHash) {
+			return
+		}
+		if errors.Is(err, database.ErrUnknownDependency) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Errorf("Failed to create scheduled job: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to create schedule")
 		return
 	}
 
+	respondJSON(w, http.StatusCreated, job)
+}
+
+// newJob validates a schedule request and builds the job it describes,
+// rendering its payload from a template if it names one. The error is
+// suitable for returning to the client unless it is errTemplateLookup.
+func (s *Server) newJob(req scheduleRequest) (*database.ScheduledJob, error) {
+	var template *database.JobTemplate
+	if req.Template != "" {
+		if len(req.Payload) > 0 {
+			return nil, fmt.Errorf("payload and template cannot both be given")
+		}
+
+		var err error
+		template, err = s.db.GetTemplate(req.Template, req.TemplateVersion)
+		if err != nil {
+			log.Errorf("Failed to get template: %v", err)
+			return nil, errTemplateLookup
+		}
+		if template == nil {
+			return nil, fmt.Errorf("template %q not found", req.Template)
+		}
+		if req.JobType == "" {
+			req.JobType = template.JobType
+		}
+		if req.JobType != template.JobType {
+			return nil, fmt.Errorf("template %q is for %s jobs", template.Name, template.JobType)
+		}
+
+		rendered, err := scheduler.RenderTemplate(*template, req.Params)
+		if err != nil {
+			return nil, err
+		}
+		req.Payload = json.RawMessage(rendered)
+	} else if len(req.Params) > 0 {
+		return nil, fmt.Errorf("params require a template")
+	}
+
+	if !database.ValidJobTypes[req.JobType] {
+		return nil, fmt.Errorf("Invalid job_type")
+	}
+
+	if len(req.Payload) == 0 {
+		return nil, fmt.Errorf("payload is required")
+	}
+
+	if req.ScheduleTime == "" {
+		return nil, fmt.Errorf("schedule_time is required")
+	}
+
+	scheduleTime, err := s.parseScheduleTime(req.ScheduleTime, req.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	if scheduleTime.Before(time.Now()) {
+		return nil, fmt.Errorf("schedule_time must be in the future")
+	}
+
 	approvalStatus := req.ApprovalStatus
 	if approvalStatus == "" {
 		approvalStatus = database.ApprovalAutoApproved
 	}
 
+	priority := s.cfg.Scheduler.PriorityFor(req.JobType)
+	if req.Priority != nil {
+		priority = *req.Priority
+	}
+
 	job := &database.ScheduledJob{
 		JobType:         req.JobType,
 		Payload:         database.JSONB(req.Payload),
-		ScheduleTime:    req.ScheduleTime,
+		ScheduleTime:    scheduleTime,
 		Tags:            req.Tags,
 		TargetUserEmail: req.TargetUserEmail,
 		RequestedBy:     req.RequestedBy,
 		ApprovalStatus:  approvalStatus,
+		DryRun:          req.DryRun,
+		DependsOn:       req.DependsOn,
+		Priority:        priority,
+	}
+	if template != nil {
+		job.TemplateName = &template.Name
+		job.TemplateVersion = &template.Version
 	}
+	return job, nil
+}
 
-	if err := s.db.CreateScheduledJob(job); err != nil {
-		log.Errorf("Failed to create scheduled job: %v", err)
+// replayIdempotentRequest answers a request whose idempotency key was used
+// before: the original job if the request body matches, or a conflict if it
+// does not. It returns false if no job holds the key yet.
+func (s *Server) replayIdempotentRequest(w http.ResponseWriter, key, requestHash string) bool {
+	existing, err := s.db.GetJobByIdempotencyKey(key)
+	if err != nil {
+		log.Errorf("Failed to look up idempotency key: %v", err)
 		respondError(w, http.StatusInternalServerError, "Failed to create schedule")
-		return
+		return true
+	}
+	if existing == nil {
+		return false
 	}
 
-	respondJSON(w, http.StatusCreated, job)
+	if existing.RequestHash == nil || *existing.RequestHash != requestHash {
+		respondError(w, http.StatusConflict, "Idempotency key was already used with a different request")
+		return true
+	}
+
+	w.Header().Set("Idempotent-Replayed", "true")
+	respondJSON(w, http.StatusOK, existing)
+	return true
+}
+
+// hashScheduleRequest fingerprints a schedule request so retries carrying
+// the same idempotency key can be told apart from conflicting reuse. The key
+// itself is excluded and the payload is compacted, so formatting differences
+// do not matter.
+func hashScheduleRequest(req scheduleRequest) (string, error) {
+	req.IdempotencyKey = ""
+	if len(req.Payload) > 0 {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, req.Payload); err != nil {
+			return "", err
+		}
+		req.Payload = compact.Bytes()
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
 }
 
 // listSchedules lists scheduled jobs with optional filters
@@ -205,6 +404,116 @@ func (s *Server) getSchedule(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, job)
 }
 
+// updateSchedule edits a pending job. The request must carry the updated_at
+// value the client last saw; if the job changed since, 412 is returned with
+// the current job so the client can merge and retry.
+func (s *Server) updateSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	var req struct {
+		UpdatedAt       *time.Time      `json:"updated_at"`
+		ScheduleTime    *string         `json:"schedule_time,omitempty"`
+		Timezone        string          `json:"timezone,omitempty"`
+		Tags            *[]string       `json:"tags,omitempty"`
+		Payload         json.RawMessage `json:"payload,omitempty"`
+		TargetUserEmail *string         `json:"target_user_email,omitempty"`
+		Priority        *int            `json:"priority,omitempty"`
+		EditedBy        *string         `json:"edited_by,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.UpdatedAt == nil {
+		respondError(w, http.StatusPreconditionRequired, "updated_at is required")
+		return
+	}
+
+	update := database.JobUpdate{
+		Tags:            req.Tags,
+		TargetUserEmail: req.TargetUserEmail,
+		Priority:        req.Priority,
+		EditedBy:        req.EditedBy,
+	}
+
+	if req.ScheduleTime != nil {
+		scheduleTime, err := s.parseScheduleTime(*req.ScheduleTime, req.Timezone)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if scheduleTime.Before(time.Now()) {
+			respondError(w, http.StatusBadRequest, "schedule_time must be in the future")
+			return
+		}
+		update.ScheduleTime = &scheduleTime
+	}
+
+	if len(req.Payload) > 0 {
+		if string(req.Payload) == "null" {
+			respondError(w, http.StatusBadRequest, "payload cannot be null")
+			return
+		}
+		update.Payload = database.JSONB(req.Payload)
+	}
+
+	job, err := s.db.UpdatePendingJob(id, *req.UpdatedAt, update)
+	switch {
+	case errors.Is(err, database.ErrStaleJob):
+		respondJSON(w, http.StatusPreconditionFailed, map[string]interface{}{
+			"error":   "Schedule was modified since updated_at; reload and retry",
+			"current": job,
+		})
+		return
+	case errors.Is(err, database.ErrJobNotEditable):
+		respondError(w, http.StatusConflict, "Only pending schedules can be edited")
+		return
+	case err != nil:
+		log.Errorf("Failed to update job: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to update schedule")
+		return
+	case job == nil:
+		respondError(w, http.StatusNotFound, "Schedule not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, job)
+}
+
+// listScheduleEdits returns the edit history of a job.
+func (s *Server) listScheduleEdits(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	job, err := s.db.GetJobByID(id)
+	if err != nil {
+		log.Errorf("Failed to get job: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to get schedule")
+		return
+	}
+	if job == nil {
+		respondError(w, http.StatusNotFound, "Schedule not found")
+		return
+	}
+
+	edits, err := s.db.ListJobEdits(id)
+	if err != nil {
+		log.Errorf("Failed to list job edits: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list edits")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, edits)
+}
+
 // cancelSchedule cancels a scheduled job
 func (s *Server) cancelSchedule(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -216,13 +525,34 @@ func (s *Server) cancelSchedule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.db.CancelJob(id); err != nil {
+	cancelledBy := r.URL.Query().Get("cancelled_by")
+	if cancelledBy == "" {
+		cancelledBy = "unknown"
+	}
+
+	previous, err := s.scheduler.CancelJob(id, cancelledBy)
+	if errors.Is(err, database.ErrJobNotCancellable) {
+		respondError(w, http.StatusConflict, "Schedule not found or already finished")
+		return
+	}
+	if err != nil {
 		log.Errorf("Failed to cancel job: %v", err)
 		respondError(w, http.StatusInternalServerError, "Failed to cancel schedule")
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]string{"message": "Schedule cancelled successfully"})
+	if previous == database.StatusExecuting {
+		respondJSON(w, http.StatusAccepted, map[string]string{
+			"message": "Cancellation requested; the running execution is being stopped",
+			"status":  previous,
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{
+		"message": "Schedule cancelled successfully",
+		"status":  database.StatusCancelled,
+	})
 }
 
 // executeSchedule triggers immediate execution of a scheduled job
@@ -230,27 +560,1466 @@ func (s *Server) executeSchedule(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
-	if err := s.scheduler.ExecuteImmediately(idStr); err != nil {
+	err := s.scheduler.ExecuteImmediately(idStr)
+	switch {
+	case errors.Is(err, scheduler.ErrJobNotFound):
+		respondError(w, http.StatusNotFound, "Schedule not found")
+		return
+	case errors.Is(err, scheduler.ErrJobNotRunnable):
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, scheduler.ErrPoolFull):
+		respondError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	case err != nil:
 		log.Errorf("Failed to execute job: %v", err)
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to execute schedule")
 		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Job execution started"})
 }
 
-// healthCheck returns the health status
-func (s *Server) healthCheck(w http.ResponseWriter, r *http.Request) {
-	health := map[string]interface{}{
-		"status":    "healthy",
-		"timestamp": time.Now(),
-		"version":   "1.0.0",
+// listScheduleAttempts returns the execution history of a scheduled job
+func (s *Server) listScheduleAttempts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID format")
+		return
 	}
 
-	respondJSON(w, http.StatusOK, health)
+	job, err := s.db.GetJobByID(id)
+	if err != nil {
+		log.Errorf("Failed to get job: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to get schedule")
+		return
+	}
+
+	if job == nil {
+		respondError(w, http.StatusNotFound, "Schedule not found")
+		return
+	}
+
+	attempts, err := s.db.ListJobAttempts(id)
+	if err != nil {
+		log.Errorf("Failed to list job attempts: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list attempts")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, attempts)
 }
 
-// Helper functions
+// listChangeRequestAttempts returns the execution history of a change request
+func (s *Server) listChangeRequestAttempts(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	cr, err := s.db.GetChangeRequestByID(id)
+	if err != nil {
+		log.Errorf("Failed to get change request: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to get change request")
+		return
+	}
+	if cr == nil {
+		respondError(w, http.StatusNotFound, "Change request not found")
+		return
+	}
+
+	attempts, err := s.db.ListChangeRequestAttempts(id)
+	if err != nil {
+		log.Errorf("Failed to list change request attempts: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list attempts")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, attempts)
+}
+
+// schedulerStats returns worker pool usage and queue depth
+func (s *Server) schedulerStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.scheduler.Stats()
+	if err != nil {
+		log.Errorf("Failed to get scheduler stats: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to get scheduler stats")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, stats)
+}
+
+// planRequest is the body of POST /api/plans. Each step is scheduled at
+// start_time plus its offset and runs once the steps it depends on have
+// completed. A step without depends_on follows the step before it; an empty
+// depends_on lets it run on its own schedule.
+type planRequest struct {
+	Name            string            `json:"name"`
+	StartTime       string            `json:"start_time,omitempty"`
+	Timezone        string            `json:"timezone,omitempty"`
+	TargetUserEmail *string           `json:"target_user_email,omitempty"`
+	RequestedBy     *string           `json:"requested_by,omitempty"`
+	ApprovalStatus  string            `json:"approval_status,omitempty"`
+	Tags            []string          `json:"tags"`
+	DryRun          bool              `json:"dry_run,omitempty"`
+	Steps           []planStepRequest `json:"steps"`
+}
+
+// planStepRequest is one step of a planRequest. Offset is like "0",
+// "36h" or "30d"; days are calendar days in the plan's timezone.
+type planStepRequest struct {
+	Name      string          `json:"name,omitempty"` // defaults to job_type
+	JobType   string          `json:"job_type"`
+	Offset    string          `json:"offset,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+	DependsOn *[]string       `json:"depends_on,omitempty"`
+	Priority  *int            `json:"priority,omitempty"` // defaults to the job type's priority
+}
+
+// createPlan creates the steps of a multi-step lifecycle change as linked
+// jobs.
+func (s *Server) createPlan(w http.ResponseWriter, r *http.Request) {
+	var req planRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name == "" {
+		respondError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if len(req.Steps) == 0 {
+		respondError(w, http.StatusBadRequest, "steps are required")
+		return
+	}
+
+	loc, err := s.resolveLocation(req.Timezone)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	start := time.Now().UTC()
+	if req.StartTime != "" {
+		start, err = s.parseScheduleTime(req.StartTime, req.Timezone)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if start.Before(time.Now()) {
+			respondError(w, http.StatusBadRequest, "start_time must be in the future")
+			return
+		}
+	}
+
+	approvalStatus := req.ApprovalStatus
+	if approvalStatus == "" {
+		approvalStatus = database.ApprovalAutoApproved
+	}
+
+	plan := &database.JobPlan{
+		Name:            req.Name,
+		TargetUserEmail: req.TargetUserEmail,
+		StartTime:       start,
+		CreatedBy:       req.RequestedBy,
+	}
+
+	stepIDs := map[string]uuid.UUID{}
+	for i, step := range req.Steps {
+		name := step.Name
+		if name == "" {
+			name = step.JobType
+		}
+		if _, dup := stepIDs[name]; dup {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("step %d: duplicate step name %q", i+1, name))
+			return
+		}
+		if !database.ValidJobTypes[step.JobType] {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("step %q: invalid job_type", name))
+			return
+		}
+		if len(step.Payload) == 0 {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("step %q: payload is required", name))
+			return
+		}
+		days, offset, err := parseOffset(step.Offset)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("step %q: %v", name, err))
+			return
+		}
+
+		var dependsOn []uuid.UUID
+		switch {
+		case step.DependsOn != nil:
+			for _, dep := range *step.DependsOn {
+				id, ok := stepIDs[dep]
+				if !ok {
+					respondError(w, http.StatusBadRequest, fmt.Sprintf("step %q: depends on unknown or later step %q", name, dep))
+					return
+				}
+				dependsOn = append(dependsOn, id)
+			}
+		case i > 0:
+			dependsOn = []uuid.UUID{plan.Steps[i-1].ID}
+		}
+
+		priority := s.cfg.Scheduler.PriorityFor(step.JobType)
+		if step.Priority != nil {
+			priority = *step.Priority
+		}
+
+		id := uuid.New()
+		stepIDs[name] = id
+		plan.Steps = append(plan.Steps, database.ScheduledJob{
+			ID:              id,
+			JobType:         step.JobType,
+			Payload:         database.JSONB(step.Payload),
+			ScheduleTime:    start.In(loc).AddDate(0, 0, days).Add(offset).UTC(),
+			Tags:            req.Tags,
+			TargetUserEmail: req.TargetUserEmail,
+			RequestedBy:     req.RequestedBy,
+			ApprovalStatus:  approvalStatus,
+			DryRun:          req.DryRun,
+			PlanStep:        &name,
+			DependsOn:       dependsOn,
+			Priority:        priority,
+		})
+	}
+
+	if err := s.db.CreatePlan(plan); err != nil {
+		log.Errorf("Failed to create plan: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to create plan")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, plan)
+}
+
+// getPlan returns a plan with the current state of its steps
+func (s *Server) getPlan(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	plan, err := s.db.GetPlan(id)
+	if err != nil {
+		log.Errorf("Failed to get plan: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to get plan")
+		return
+	}
+	if plan == nil {
+		respondError(w, http.StatusNotFound, "Plan not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, plan)
+}
+
+// cancelPlan cancels every step of a plan that has not finished
+func (s *Server) cancelPlan(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	cancelledBy := r.URL.Query().Get("cancelled_by")
+	if cancelledBy == "" {
+		cancelledBy = "unknown"
+	}
+
+	plan, err := s.scheduler.CancelPlan(id, cancelledBy)
+	if err != nil {
+		log.Errorf("Failed to cancel plan: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to cancel plan")
+		return
+	}
+	if plan == nil {
+		respondError(w, http.StatusNotFound, "Plan not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, plan)
+}
+
+// retryPlan returns the failed steps of a held plan to pending, which lets
+// the rest of the plan continue
+func (s *Server) retryPlan(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	retried, err := s.db.RetryPlan(id)
+	if errors.Is(err, database.ErrPlanCancelled) {
+		respondError(w, http.StatusConflict, "Plan was cancelled")
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to retry plan: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to retry plan")
+		return
+	}
+	if retried == 0 {
+		respondError(w, http.StatusConflict, "Plan not found or has no failed steps")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Failed steps returned to pending",
+		"retried": retried,
+	})
+}
+
+// maxBatchRows caps the number of jobs one batch may create.
+const maxBatchRows = 1000
+
+// batchRowError reports why one row of a batch was rejected. Rows are
+// numbered from 1, not counting a CSV header.
+type batchRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// createBatch creates the jobs of a bulk upload in one transaction. The body
+// is a JSON array of schedule requests, or CSV with a header row when sent as
+// text/csv. The query parameters name (required), created_by, and the row
+// defaults job_type, schedule_time and timezone apply to the whole batch.
+// Every row is validated first; if any is invalid nothing is created and
+// the errors are reported per row.
+func (s *Server) createBatch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	name := query.Get("name")
+	if name == "" {
+		respondError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	var rows []scheduleRequest
+	var rowErrors []batchRowError
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		var err error
+		rows, rowErrors, err = parseBatchCSV(r.Body)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	case "", "application/json":
+		if err := json.NewDecoder(r.Body).Decode(&rows); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body: expected a JSON array")
+			return
+		}
+	default:
+		respondError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json or text/csv")
+		return
+	}
+
+	if len(rows) == 0 {
+		respondError(w, http.StatusBadRequest, "batch has no rows")
+		return
+	}
+	if len(rows) > maxBatchRows {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("batch has %d rows; at most %d are allowed", len(rows), maxBatchRows))
+		return
+	}
+
+	batch := &database.JobBatch{Name: name}
+	if createdBy := query.Get("created_by"); createdBy != "" {
+		batch.CreatedBy = &createdBy
+	}
+
+	failed := map[int]bool{}
+	for _, rowErr := range rowErrors {
+		failed[rowErr.Row] = true
+	}
+	for i, row := range rows {
+		if failed[i+1] {
+			continue
+		}
+		if row.JobType == "" {
+			row.JobType = query.Get("job_type")
+		}
+		if row.ScheduleTime == "" {
+			row.ScheduleTime = query.Get("schedule_time")
+		}
+		if row.Timezone == "" {
+			row.Timezone = query.Get("timezone")
+		}
+		if row.RequestedBy == nil {
+			row.RequestedBy = batch.CreatedBy
+		}
+		if row.IdempotencyKey != "" {
+			rowErrors = append(rowErrors, batchRowError{Row: i + 1, Error: "idempotency_key is not supported in batches"})
+			continue
+		}
+
+		job, err := s.newJob(row)
+		if errors.Is(err, errTemplateLookup) {
+			respondError(w, http.StatusInternalServerError, "Failed to load template")
+			return
+		}
+		if err != nil {
+			rowErrors = append(rowErrors, batchRowError{Row: i + 1, Error: err.Error()})
+			continue
+		}
+		batch.Jobs = append(batch.Jobs, *job)
+	}
+
+	if len(rowErrors) > 0 {
+		sort.Slice(rowErrors, func(a, b int) bool { return rowErrors[a].Row < rowErrors[b].Row })
+		respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  fmt.Sprintf("%d of %d rows are invalid; no jobs were created", len(rowErrors), len(rows)),
+			"errors": rowErrors,
+		})
+		return
+	}
+
+	if err := s.db.CreateBatch(batch); err != nil {
+		if errors.Is(err, database.ErrUnknownDependency) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Errorf("Failed to create batch: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to create batch")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, batch)
+}
+
+// parseBatchCSV reads batch rows from CSV with a header row. Columns named
+// after schedule request fields set those fields; tags and depends_on hold
+// values separated by "|". A payload column holds a JSON object, and
+// payload.<path> columns set fields within it, e.g. payload.employee.fullName.
+// params.<name> columns set template parameters.
+// Cells that are valid JSON, such as numbers and true or false, are taken as
+// JSON and others as strings; empty cells are left out. Rows that cannot be
+// read are returned as row errors.
+func parseBatchCSV(body io.Reader) ([]scheduleRequest, []batchRowError, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("batch has no rows")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV header: %v", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	var rows []scheduleRequest
+	var rowErrors []batchRowError
+	for n := 1; ; n++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, nil, fmt.Errorf("failed to read CSV: %v", err)
+			}
+			rows = append(rows, scheduleRequest{})
+			rowErrors = append(rowErrors, batchRowError{Row: n, Error: parseErr.Err.Error()})
+			continue
+		}
+
+		row, err := csvScheduleRequest(header, record)
+		if err != nil {
+			rowErrors = append(rowErrors, batchRowError{Row: n, Error: err.Error()})
+		}
+		rows = append(rows, row)
+	}
+	return rows, rowErrors, nil
+}
+
+// csvScheduleRequest builds a schedule request from one CSV record.
+func csvScheduleRequest(header, record []string) (scheduleRequest, error) {
+	var req scheduleRequest
+	payload := map[string]interface{}{}
+
+	for i, column := range header {
+		value := strings.TrimSpace(record[i])
+		if value == "" {
+			continue
+		}
+
+		switch column {
+		case "job_type":
+			req.JobType = value
+		case "schedule_time":
+			req.ScheduleTime = value
+		case "timezone":
+			req.Timezone = value
+		case "tags":
+			req.Tags = strings.Split(value, "|")
+		case "target_user_email":
+			req.TargetUserEmail = &value
+		case "requested_by":
+			req.RequestedBy = &value
+		case "approval_status":
+			req.ApprovalStatus = value
+		case "idempotency_key":
+			req.IdempotencyKey = value
+		case "template":
+			req.Template = value
+		case "template_version":
+			version, err := strconv.Atoi(value)
+			if err != nil {
+				return req, fmt.Errorf("template_version must be an integer")
+			}
+			req.TemplateVersion = version
+		case "priority":
+			priority, err := strconv.Atoi(value)
+			if err != nil {
+				return req, fmt.Errorf("priority must be an integer")
+			}
+			req.Priority = &priority
+		case "dry_run":
+			dryRun, err := strconv.ParseBool(value)
+			if err != nil {
+				return req, fmt.Errorf("dry_run must be true or false")
+			}
+			req.DryRun = dryRun
+		case "depends_on":
+			for _, dep := range strings.Split(value, "|") {
+				id, err := uuid.Parse(strings.TrimSpace(dep))
+				if err != nil {
+					return req, fmt.Errorf("depends_on: invalid ID %q", dep)
+				}
+				req.DependsOn = append(req.DependsOn, id)
+			}
+		case "payload":
+			var base map[string]interface{}
+			if err := json.Unmarshal([]byte(value), &base); err != nil {
+				return req, fmt.Errorf("payload must be a JSON object")
+			}
+			for k, v := range base {
+				if _, set := payload[k]; !set {
+					payload[k] = v
+				}
+			}
+		default:
+			if param, ok := strings.CutPrefix(column, "params."); ok && param != "" {
+				if req.Params == nil {
+					req.Params = map[string]interface{}{}
+				}
+				req.Params[param] = csvValue(value)
+				continue
+			}
+			path, ok := strings.CutPrefix(column, "payload.")
+			if !ok || path == "" {
+				return req, fmt.Errorf("unknown column %q", column)
+			}
+			if err := setPayloadPath(payload, strings.Split(path, "."), csvValue(value)); err != nil {
+				return req, fmt.Errorf("column %q: %v", column, err)
+			}
+		}
+	}
+
+	if len(payload) > 0 {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return req, fmt.Errorf("invalid payload: %v", err)
+		}
+		req.Payload = data
+	}
+	return req, nil
+}
+
+// csvValue interprets a CSV cell as JSON if it is valid JSON, otherwise as a
+// string.
+func csvValue(value string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return value
+	}
+	return v
+}
+
+// setPayloadPath sets the field at path within payload, creating objects
+// along the way.
+func setPayloadPath(payload map[string]interface{}, path []string, value interface{}) error {
+	for _, key := range path[:len(path)-1] {
+		next, ok := payload[key]
+		if !ok {
+			child := map[string]interface{}{}
+			payload[key] = child
+			payload = child
+			continue
+		}
+		child, ok := next.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not an object", key)
+		}
+		payload = child
+	}
+	payload[path[len(path)-1]] = value
+	return nil
+}
+
+// getBatch returns a batch with its jobs and progress
+func (s *Server) getBatch(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	batch, err := s.db.GetBatch(id)
+	if err != nil {
+		log.Errorf("Failed to get batch: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to get batch")
+		return
+	}
+	if batch == nil {
+		respondError(w, http.StatusNotFound, "Batch not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, batch)
+}
+
+// cancelBatch cancels every job of a batch that has not finished
+func (s *Server) cancelBatch(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	cancelledBy := r.URL.Query().Get("cancelled_by")
+	if cancelledBy == "" {
+		cancelledBy = "unknown"
+	}
+
+	batch, err := s.scheduler.CancelBatch(id, cancelledBy)
+	if err != nil {
+		log.Errorf("Failed to cancel batch: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to cancel batch")
+		return
+	}
+	if batch == nil {
+		respondError(w, http.StatusNotFound, "Batch not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, batch)
+}
+
+// replayBatch replays every failed job of a batch that has not been
+// replayed yet
+func (s *Server) replayBatch(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	replayedBy := r.URL.Query().Get("replayed_by")
+	if replayedBy == "" {
+		respondError(w, http.StatusBadRequest, "replayed_by is required")
+		return
+	}
+
+	batch, err := s.db.GetBatch(id)
+	if err != nil {
+		log.Errorf("Failed to get batch: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to get batch")
+		return
+	}
+	if batch == nil {
+		respondError(w, http.StatusNotFound, "Batch not found")
+		return
+	}
+	if batch.CancelledAt != nil {
+		respondError(w, http.StatusConflict, "Batch was cancelled")
+		return
+	}
+
+	jobs, err := s.db.ListDeadLetters(database.DeadLetterFilter{BatchID: &id})
+	if err != nil {
+		log.Errorf("Failed to list dead letters: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list dead letters")
+		return
+	}
+
+	s.replayAll(w, jobs, replayedBy)
+}
+
+// templateRequest is the body of POST /api/templates.
+type templateRequest struct {
+	Name        string                  `json:"name"`
+	JobType     string                  `json:"job_type"`
+	Description *string                 `json:"description,omitempty"`
+	Payload     json.RawMessage         `json:"payload"`
+	Parameters  database.TemplateParams `json:"parameters"`
+	CreatedBy   *string                 `json:"created_by,omitempty"`
+}
+
+// createTemplate saves a new version of a job template
+func (s *Server) createTemplate(w http.ResponseWriter, r *http.Request) {
+	var req templateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	template := &database.JobTemplate{
+		Name:        req.Name,
+		JobType:     req.JobType,
+		Description: req.Description,
+		Payload:     database.JSONB(req.Payload),
+		Parameters:  req.Parameters,
+		CreatedBy:   req.CreatedBy,
+	}
+	if template.Parameters == nil {
+		template.Parameters = database.TemplateParams{}
+	}
+	if err := scheduler.ValidateTemplate(*template); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.db.CreateTemplate(template); err != nil {
+		log.Errorf("Failed to create template: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to create template")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, template)
+}
+
+// listTemplates returns the latest version of every job template
+func (s *Server) listTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := s.db.ListTemplates()
+	if err != nil {
+		log.Errorf("Failed to list templates: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list templates")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, templates)
+}
+
+// getTemplate returns a job template, by default its latest version
+func (s *Server) getTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := s.lookupTemplate(w, mux.Vars(r)["name"], r.URL.Query().Get("version"))
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, template)
+}
+
+// listTemplateVersions returns every version of a job template
+func (s *Server) listTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	templates, err := s.db.ListTemplateVersions(mux.Vars(r)["name"])
+	if err != nil {
+		log.Errorf("Failed to list template versions: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list template versions")
+		return
+	}
+	if len(templates) == 0 {
+		respondError(w, http.StatusNotFound, "Template not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, templates)
+}
+
+// renderTemplate returns the payload a template renders for the given
+// params, without scheduling anything
+func (s *Server) renderTemplate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Version int                    `json:"version,omitempty"`
+		Params  map[string]interface{} `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	template, ok := s.lookupTemplate(w, mux.Vars(r)["name"], strconv.Itoa(req.Version))
+	if !ok {
+		return
+	}
+
+	payload, err := scheduler.RenderTemplate(*template, req.Params)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"template": template.Name,
+		"version":  template.Version,
+		"job_type": template.JobType,
+		"payload":  json.RawMessage(payload),
+	})
+}
+
+// lookupTemplate loads a template version, or the latest if version is
+// empty or "0", answering the request itself if it cannot.
+func (s *Server) lookupTemplate(w http.ResponseWriter, name, version string) (*database.JobTemplate, bool) {
+	v := 0
+	if version != "" {
+		var err error
+		v, err = strconv.Atoi(version)
+		if err != nil || v < 0 {
+			respondError(w, http.StatusBadRequest, "version must be a positive integer")
+			return nil, false
+		}
+	}
+
+	template, err := s.db.GetTemplate(name, v)
+	if err != nil {
+		log.Errorf("Failed to get template: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to get template")
+		return nil, false
+	}
+	if template == nil {
+		respondError(w, http.StatusNotFound, "Template not found")
+		return nil, false
+	}
+	return template, true
+}
+
+// recurringRequest is the body of POST /api/recurring.
+type recurringRequest struct {
+	Name            string          `json:"name"`
+	JobType         string          `json:"job_type"`
+	Payload         json.RawMessage `json:"payload"`
+	Schedule        string          `json:"schedule"` // cron expression or RRULE
+	Timezone        string          `json:"timezone,omitempty"`
+	StartTime       string          `json:"start_time,omitempty"`
+	EndTime         string          `json:"end_time,omitempty"`
+	Tags            []string        `json:"tags"`
+	TargetUserEmail *string         `json:"target_user_email,omitempty"`
+	RequestedBy     *string         `json:"requested_by,omitempty"`
+}
+
+// createRecurring creates a recurring job definition and materializes its
+// first occurrences straight away.
+func (s *Server) createRecurring(w http.ResponseWriter, r *http.Request) {
+	var req recurringRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name == "" {
+		respondError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if !database.ValidJobTypes[req.JobType] {
+		respondError(w, http.StatusBadRequest, "Invalid job_type")
+		return
+	}
+	if len(req.Payload) == 0 {
+		respondError(w, http.StatusBadRequest, "payload is required")
+		return
+	}
+	if req.Schedule == "" {
+		respondError(w, http.StatusBadRequest, "schedule is required")
+		return
+	}
+
+	loc, err := s.resolveLocation(req.Timezone)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rj := &database.RecurringJob{
+		Name:            req.Name,
+		JobType:         req.JobType,
+		Payload:         database.JSONB(req.Payload),
+		Tags:            req.Tags,
+		TargetUserEmail: req.TargetUserEmail,
+		RequestedBy:     req.RequestedBy,
+		Schedule:        req.Schedule,
+		Timezone:        loc.String(),
+		StartTime:       time.Now().UTC(),
+	}
+
+	if req.StartTime != "" {
+		rj.StartTime, err = s.parseScheduleTime(req.StartTime, req.Timezone)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.EndTime != "" {
+		end, err := s.parseScheduleTime(req.EndTime, req.Timezone)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !end.After(rj.StartTime) || end.Before(time.Now()) {
+			respondError(w, http.StatusBadRequest, "end_time must be after start_time and in the future")
+			return
+		}
+		rj.EndTime = &end
+	}
+
+	recurrence, err := s.scheduler.RecurrenceFor(*rj)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	next := recurrence.Next(time.Now())
+	if next.IsZero() || (rj.EndTime != nil && next.After(*rj.EndTime)) {
+		respondError(w, http.StatusBadRequest, "schedule has no occurrences before end_time")
+		return
+	}
+
+	if err := s.db.CreateRecurringJob(rj); err != nil {
+		log.Errorf("Failed to create recurring job: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to create recurring job")
+		return
+	}
+
+	if _, err := s.scheduler.MaterializeRecurring(*rj); err != nil {
+		// The next tick retries.
+		log.WithField("recurring_job_id", rj.ID).Errorf("Failed to materialize recurring job: %v", err)
+	}
+
+	if current, err := s.db.GetRecurringJob(rj.ID); err == nil && current != nil {
+		rj = current
+	}
+	respondJSON(w, http.StatusCreated, rj)
+}
+
+// listRecurring lists recurring job definitions
+func (s *Server) listRecurring(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.db.ListRecurringJobs()
+	if err != nil {
+		log.Errorf("Failed to list recurring jobs: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list recurring jobs")
+		return
+	}
+	if jobs == nil {
+		jobs = []database.RecurringJob{}
+	}
+
+	respondJSON(w, http.StatusOK, jobs)
+}
+
+// getRecurring returns a recurring job definition
+func (s *Server) getRecurring(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	rj, err := s.db.GetRecurringJob(id)
+	if err != nil {
+		log.Errorf("Failed to get recurring job: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to get recurring job")
+		return
+	}
+	if rj == nil {
+		respondError(w, http.StatusNotFound, "Recurring job not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, rj)
+}
+
+// pauseRecurring stops a recurring job from creating occurrences and cancels
+// its pending ones.
+func (s *Server) pauseRecurring(w http.ResponseWriter, r *http.Request) {
+	s.setRecurringPaused(w, r, true)
+}
+
+// resumeRecurring lets a paused recurring job create occurrences again.
+func (s *Server) resumeRecurring(w http.ResponseWriter, r *http.Request) {
+	s.setRecurringPaused(w, r, false)
+}
+
+func (s *Server) setRecurringPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	var req struct {
+		Actor string `json:"actor"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Actor == "" {
+		respondError(w, http.StatusBadRequest, "actor is required")
+		return
+	}
+
+	rj, err := s.db.SetRecurringJobPaused(id, paused, req.Actor)
+	if err != nil {
+		log.Errorf("Failed to update recurring job: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to update recurring job")
+		return
+	}
+	if rj == nil {
+		respondError(w, http.StatusNotFound, "Recurring job not found")
+		return
+	}
+
+	if !paused {
+		if _, err := s.scheduler.MaterializeRecurring(*rj); err != nil {
+			log.WithField("recurring_job_id", rj.ID).Errorf("Failed to materialize recurring job: %v", err)
+		}
+	}
+
+	respondJSON(w, http.StatusOK, rj)
+}
+
+// deleteRecurring deletes a recurring job definition and cancels its pending
+// occurrences
+func (s *Server) deleteRecurring(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	deletedBy := r.URL.Query().Get("deleted_by")
+	if deletedBy == "" {
+		deletedBy = "unknown"
+	}
+
+	deleted, err := s.db.DeleteRecurringJob(id, deletedBy)
+	if err != nil {
+		log.Errorf("Failed to delete recurring job: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to delete recurring job")
+		return
+	}
+	if !deleted {
+		respondError(w, http.StatusNotFound, "Recurring job not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Recurring job deleted"})
+}
+
+// replayRequest is the body of POST /api/schedule/{id}/replay. Leaving out
+// payload keeps the original; leaving out schedule_time runs the replay now.
+type replayRequest struct {
+	Payload      json.RawMessage `json:"payload,omitempty"`
+	ScheduleTime string          `json:"schedule_time,omitempty"`
+	Timezone     string          `json:"timezone,omitempty"`
+	ReplayedBy   string          `json:"replayed_by"`
+}
+
+// replaySchedule clones a failed job into a new pending job
+func (s *Server) replaySchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	var req replayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.ReplayedBy == "" {
+		respondError(w, http.StatusBadRequest, "replayed_by is required")
+		return
+	}
+
+	opts := database.ReplayOptions{ReplayedBy: req.ReplayedBy}
+	if len(req.Payload) > 0 {
+		if string(req.Payload) == "null" {
+			respondError(w, http.StatusBadRequest, "payload cannot be null")
+			return
+		}
+		opts.Payload = database.JSONB(req.Payload)
+	}
+	if req.ScheduleTime != "" {
+		scheduleTime, err := s.parseScheduleTime(req.ScheduleTime, req.Timezone)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if scheduleTime.Before(time.Now()) {
+			respondError(w, http.StatusBadRequest, "schedule_time must be in the future")
+			return
+		}
+		opts.ScheduleTime = &scheduleTime
+	}
+
+	job, err := s.db.ReplayJob(id, opts)
+	switch {
+	case errors.Is(err, database.ErrJobNotReplayable):
+		respondError(w, http.StatusConflict, "Only failed schedules can be replayed")
+		return
+	case errors.Is(err, database.ErrAlreadyReplayed):
+		respondError(w, http.StatusConflict, "Schedule was already replayed")
+		return
+	case err != nil:
+		log.Errorf("Failed to replay job: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to replay schedule")
+		return
+	case job == nil:
+		respondError(w, http.StatusNotFound, "Schedule not found")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, job)
+}
+
+// deadLetterFilter reads the dead-letter filters shared by listing and bulk
+// replay from query parameters.
+func deadLetterFilter(query url.Values) (database.DeadLetterFilter, error) {
+	var filter database.DeadLetterFilter
+
+	if v := query.Get("type"); v != "" {
+		filter.JobType = &v
+	}
+	if v := query.Get("reason"); v != "" {
+		filter.FailureReason = &v
+	}
+	if v := query.Get("tag"); v != "" {
+		filter.Tag = &v
+	}
+	if v := query.Get("batch_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return filter, fmt.Errorf("batch_id must be a UUID")
+		}
+		filter.BatchID = &id
+	}
+	for name, dest := range map[string]**time.Time{
+		"failed_after":  &filter.FailedAfter,
+		"failed_before": &filter.FailedBefore,
+	} {
+		if v := query.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be RFC 3339", name)
+			}
+			*dest = &t
+		}
+	}
+	return filter, nil
+}
+
+// listDeadLetters returns failed jobs that have not been replayed
+func (s *Server) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter, err := deadLetterFilter(query)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter.Limit = 100
+	if l := query.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			filter.Limit = parsed
+		}
+	}
+	if o := query.Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil {
+			filter.Offset = parsed
+		}
+	}
+
+	jobs, err := s.db.ListDeadLetters(filter)
+	if err != nil {
+		log.Errorf("Failed to list dead letters: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list dead letters")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, jobs)
+}
+
+// replayDeadLetters replays every dead-lettered job matching the filters,
+// e.g. everything that failed during a downstream outage
+func (s *Server) replayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter, err := deadLetterFilter(query)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter == (database.DeadLetterFilter{}) {
+		respondError(w, http.StatusBadRequest, "at least one of type, reason, tag, batch_id, failed_after or failed_before is required")
+		return
+	}
+
+	replayedBy := query.Get("replayed_by")
+	if replayedBy == "" {
+		respondError(w, http.StatusBadRequest, "replayed_by is required")
+		return
+	}
+
+	jobs, err := s.db.ListDeadLetters(filter)
+	if err != nil {
+		log.Errorf("Failed to list dead letters: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list dead letters")
+		return
+	}
+
+	s.replayAll(w, jobs, replayedBy)
+}
+
+// replayAll replays each of jobs and responds with the replays. Jobs that
+// were replayed or retried concurrently are counted as skipped.
+func (s *Server) replayAll(w http.ResponseWriter, jobs []database.ScheduledJob, replayedBy string) {
+	replayed := []database.ScheduledJob{}
+	skipped := 0
+	for _, job := range jobs {
+		replay, err := s.db.ReplayJob(job.ID, database.ReplayOptions{ReplayedBy: replayedBy})
+		if errors.Is(err, database.ErrAlreadyReplayed) || errors.Is(err, database.ErrJobNotReplayable) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			log.WithField("id", job.ID).Errorf("Failed to replay job: %v", err)
+			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"error":    "Failed to replay all dead letters",
+				"replayed": replayed,
+				"skipped":  skipped,
+			})
+			return
+		}
+		if replay != nil {
+			replayed = append(replayed, *replay)
+		}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"replayed": replayed,
+		"skipped":  skipped,
+	})
+}
+
+// receiveCallback records the outcome reported by a target that accepted a
+// job with 202. The token in the path identifies the job and attempt.
+func (s *Server) receiveCallback(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	var cb scheduler.Callback
+	if err := json.NewDecoder(r.Body).Decode(&cb); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(cb.Results) > 0 && !json.Valid(cb.Results) {
+		respondError(w, http.StatusBadRequest, "Invalid results")
+		return
+	}
+
+	job, err := s.scheduler.HandleCallback(token, cb)
+	if errors.Is(err, scheduler.ErrCallbackNotFound) {
+		respondError(w, http.StatusNotFound, "No job is awaiting this callback")
+		return
+	}
+	if errors.Is(err, scheduler.ErrInvalidCallback) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to handle callback: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to handle callback")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, job)
+}
+
+// pauseRequest is the body of POST /api/admin/pause and /api/admin/resume.
+// An empty job_type means all job types.
+type pauseRequest struct {
+	JobType string `json:"job_type,omitempty"`
+	Reason  string `json:"reason"`
+	Actor   string `json:"actor"`
+}
+
+// decodePauseRequest parses and validates a pause or resume request and
+// returns the pause scope it applies to.
+func decodePauseRequest(w http.ResponseWriter, r *http.Request, requireReason bool) (pauseRequest, string, bool) {
+	var req pauseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return req, "", false
+	}
+	if req.Actor == "" {
+		respondError(w, http.StatusBadRequest, "actor is required")
+		return req, "", false
+	}
+	if requireReason && req.Reason == "" {
+		respondError(w, http.StatusBadRequest, "reason is required")
+		return req, "", false
+	}
+
+	scope := database.PauseAll
+	if req.JobType != "" && req.JobType != database.PauseAll {
+		if !database.ValidJobTypes[req.JobType] {
+			respondError(w, http.StatusBadRequest, "Invalid job_type")
+			return req, "", false
+		}
+		scope = req.JobType
+	}
+	return req, scope, true
+}
+
+// pauseExecution stops claiming due jobs globally or for one job type.
+// Jobs already executing are left to finish.
+func (s *Server) pauseExecution(w http.ResponseWriter, r *http.Request) {
+	req, scope, ok := decodePauseRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	pause, err := s.db.Pause(scope, req.Reason, req.Actor)
+	if err != nil {
+		log.Errorf("Failed to pause execution: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to pause execution")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, pause)
+}
+
+// resumeExecution lifts a pause set by pauseExecution.
+func (s *Server) resumeExecution(w http.ResponseWriter, r *http.Request) {
+	req, scope, ok := decodePauseRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	resumed, err := s.db.Resume(scope, req.Reason, req.Actor)
+	if err != nil {
+		log.Errorf("Failed to resume execution: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to resume execution")
+		return
+	}
+	if !resumed {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("%s is not paused", scope))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Execution resumed", "scope": scope})
+}
+
+// healthCheck returns the health status, including any active pauses
+func (s *Server) healthCheck(w http.ResponseWriter, r *http.Request) {
+	health := map[string]interface{}{
+		"status":    "healthy",
+		"timestamp": time.Now(),
+		"version":   "1.0.0",
+	}
+
+	pauses, err := s.db.ListPauses()
+	if err != nil {
+		log.Errorf("Failed to list pauses: %v", err)
+		health["status"] = "degraded"
+	} else {
+		health["paused"] = pauses
+	}
+
+	respondJSON(w, http.StatusOK, health)
+}
+
+// Helper functions
+
+// wallClockLayouts are the local date-time formats accepted for schedule_time
+// when it carries no UTC offset.
+var wallClockLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// parseScheduleTime parses an RFC 3339 instant, or a wall-clock time such as
+// "2026-11-01 17:00" interpreted in tz (an IANA name) or, if tz is empty, in
+// the scheduler's configured timezone. The result is always in UTC.
+func (s *Server) parseScheduleTime(value, tz string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+
+	loc, err := s.resolveLocation(tz)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, layout := range wallClockLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("schedule_time must be RFC 3339 or a local time like 2006-01-02 15:04")
+}
+
+// resolveLocation returns the IANA zone tz, or the scheduler's configured
+// timezone if tz is empty.
+func (s *Server) resolveLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return s.scheduler.Location(), nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", tz)
+	}
+	return loc, nil
+}
+
+// parseOffset parses a plan step offset such as "0", "36h", "30d" or
+// "1d12h" into whole days and a remaining duration.
+func parseOffset(value string) (int, time.Duration, error) {
+	if value == "" || value == "0" {
+		return 0, 0, nil
+	}
+
+	days := 0
+	rest := value
+	if i := strings.Index(value, "d"); i >= 0 {
+		n, err := strconv.Atoi(value[:i])
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", value)
+		}
+		days, rest = n, value[i+1:]
+	}
+
+	var d time.Duration
+	if rest != "" {
+		var err error
+		d, err = time.ParseDuration(rest)
+		if err != nil || d < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", value)
+		}
+	}
+	return days, d, nil
+}
 
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -286,8 +2055,8 @@ func loggingMiddleware(next http.Handler) http.Handler {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestHashScheduleRequest(t *testing.T) {
+	parse := func(body string) scheduleRequest {
+		t.Helper()
+		var req scheduleRequest
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			t.Fatalf("invalid request %s: %v", body, err)
+		}
+		return req
+	}
+
+	const original = `{
+		"job_type": "terminate",
+		"payload": {"email": "user@example.com", "apps": ["slack", "google"]},
+		"schedule_time": "2026-11-02T09:00:00Z",
+		"tags": ["offboarding"],
+		"idempotency_key": "hr-123"
+	}`
+
+	tests := []struct {
+		name string
+		body string
+		same bool
+	}{
+		{
+			name: "identical retry",
+			body: original,
+			same: true,
+		},
+		{
+			name: "payload whitespace",
+			body: `{"job_type":"terminate","payload":{ "email" : "user@example.com" ,
+				"apps" : [ "slack" , "google" ] },"schedule_time":"2026-11-02T09:00:00Z","tags":["offboarding"],"idempotency_key":"hr-123"}`,
+			same: true,
+		},
+		{
+			name: "key moved to the header",
+			body: `{"job_type": "terminate", "payload": {"email": "user@example.com", "apps": ["slack", "google"]},
+				"schedule_time": "2026-11-02T09:00:00Z", "tags": ["offboarding"]}`,
+			same: true,
+		},
+		{
+			name: "different payload",
+			body: `{"job_type": "terminate", "payload": {"email": "other@example.com", "apps": ["slack", "google"]},
+				"schedule_time": "2026-11-02T09:00:00Z", "tags": ["offboarding"], "idempotency_key": "hr-123"}`,
+		},
+		{
+			name: "different schedule time",
+			body: `{"job_type": "terminate", "payload": {"email": "user@example.com", "apps": ["slack", "google"]},
+				"schedule_time": "2026-11-03T09:00:00Z", "tags": ["offboarding"], "idempotency_key": "hr-123"}`,
+		},
+		{
+			name: "different job type",
+			body: `{"job_type": "suspend", "payload": {"email": "user@example.com", "apps": ["slack", "google"]},
+				"schedule_time": "2026-11-02T09:00:00Z", "tags": ["offboarding"], "idempotency_key": "hr-123"}`,
+		},
+		{
+			name: "dry run",
+			body: `{"job_type": "terminate", "payload": {"email": "user@example.com", "apps": ["slack", "google"]},
+				"schedule_time": "2026-11-02T09:00:00Z", "tags": ["offboarding"], "idempotency_key": "hr-123", "dry_run": true}`,
+		},
+	}
+
+	want, err := hashScheduleRequest(parse(original))
+	if err != nil {
+		t.Fatalf("hashScheduleRequest() error: %v", err)
+	}
+	if len(want) != 64 {
+		t.Fatalf("hashScheduleRequest() = %q, want a hex SHA-256", want)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hashScheduleRequest(parse(tt.body))
+			if err != nil {
+				t.Fatalf("hashScheduleRequest() error: %v", err)
+			}
+			if tt.same && got != want {
+				t.Errorf("hash = %s, want %s", got, want)
+			}
+			if !tt.same && got == want {
+				t.Errorf("hash did not change")
+			}
+		})
+	}
+}
+
+func TestHashScheduleRequestLeavesKey(t *testing.T) {
+	req := scheduleRequest{JobType: "provision", Payload: json.RawMessage(`{ "a" : 1 }`), IdempotencyKey: "k"}
+	if _, err := hashScheduleRequest(req); err != nil {
+		t.Fatalf("hashScheduleRequest() error: %v", err)
+	}
+	if req.IdempotencyKey != "k" || string(req.Payload) != `{ "a" : 1 }` {
+		t.Errorf("hashScheduleRequest() modified the caller's request: %+v", req)
+	}
+}
@@ -2,20 +2,27 @@ package config
 
 import (
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Database       DatabaseConfig       `yaml:"database"`
-	Scheduler      SchedulerConfig      `yaml:"scheduler"`
-	Provisioning   ProvisioningConfig   `yaml:"provisioning"`
-	Termination    TerminationConfig    `yaml:"termination"`
-	DirectorySync  DirectorySyncConfig  `yaml:"directory_sync"`
-	Webhooks       map[string]string    `yaml:"webhooks"`
-	Logging        LoggingConfig        `yaml:"logging"`
-	Server         ServerConfig         `yaml:"server"`
+	Database      DatabaseConfig            `yaml:"database"`
+	Scheduler     SchedulerConfig           `yaml:"scheduler"`
+	Provisioning  ProvisioningConfig        `yaml:"provisioning"`
+	Termination   TerminationConfig         `yaml:"termination"`
+	DirectorySync DirectorySyncConfig       `yaml:"directory_sync"`
+	Webhooks      map[string]string         `yaml:"webhooks"`
+	Targets       map[string]TargetOverride `yaml:"targets"`
+	Commands      map[string]CommandConfig  `yaml:"commands"`
+	Signing       SigningConfig             `yaml:"signing"`
+	Calendar      CalendarConfig            `yaml:"calendar"`
+	Logging       LoggingConfig             `yaml:"logging"`
+	Server        ServerConfig              `yaml:"server"`
 }
 
 type DatabaseConfig struct {
@@ -25,13 +32,113 @@ type DatabaseConfig struct {
 	Password string `yaml:"password"`
 	DBName   string `yaml:"dbname"`
 	SSLMode  string `yaml:"sslmode"`
+	// SkipMigrations stops the scheduler from applying pending migrations
+	// at startup; it then refuses to start until `scheduler migrate up` has
+	// been run.
+	SkipMigrations bool `yaml:"skip_migrations"`
 }
 
 type SchedulerConfig struct {
 	CheckInterval string `yaml:"check_interval"`
 	Timezone      string `yaml:"timezone"`
 	MaxRetries    int    `yaml:"max_retries"`
-	RetryDelay    int    `yaml:"retry_delay"` // seconds
+	RetryDelay    int    `yaml:"retry_delay"`    // seconds before the first retry
+	WorkerID      string `yaml:"worker_id"`      // defaults to hostname-pid-random
+	LeaseDuration int    `yaml:"lease_duration"` // seconds a claimed job is reserved for this worker
+
+	HeartbeatInterval int `yaml:"heartbeat_interval"` // seconds between lease renewals; defaults to lease_duration/3
+
+	Workers     int            `yaml:"workers"`     // max jobs executing at once on this instance
+	Concurrency map[string]int `yaml:"concurrency"` // per job type cap on jobs executing at once
+
+	RetryMultiplier float64                        `yaml:"retry_multiplier"` // backoff growth per attempt, e.g. 2
+	RetryMaxDelay   int                            `yaml:"retry_max_delay"`  // seconds; caps the backoff
+	RetryJitter     float64                        `yaml:"retry_jitter"`     // 0-1, fraction of the delay randomised
+	RetryPolicies   map[string]RetryPolicyOverride `yaml:"retry_policies"`   // per job type overrides
+
+	ListenNotify bool `yaml:"listen_notify"` // wake on Postgres NOTIFY instead of waiting for the next check
+
+	CallbackURL     string `yaml:"callback_url"`     // public base URL of this API, sent to targets for callbacks
+	CallbackTimeout int    `yaml:"callback_timeout"` // seconds a 202-accepted job may wait for its callback
+
+	DryRun bool `yaml:"dry_run"` // rehearse every job: nothing is changed downstream
+
+	RecurringHorizon int `yaml:"recurring_horizon"` // seconds ahead recurring jobs are materialized; defaults to 7 days
+
+	Priorities      map[string]int `yaml:"priorities"`       // per job type default priority; higher runs first, default 0
+	ReservedWorkers int            `yaml:"reserved_workers"` // workers kept free for jobs at or above urgent_priority
+	UrgentPriority  int            `yaml:"urgent_priority"`  // priority that may use the reserved workers
+}
+
+// RetryPolicy controls how failed jobs are retried.
+type RetryPolicy struct {
+	MaxRetries int
+	Delay      int     // seconds
+	Multiplier float64 // growth per attempt
+	MaxDelay   int     // seconds; zero means no cap
+	Jitter     float64 // 0-1
+}
+
+// RetryPolicyOverride is a retry_policies entry. Fields left out fall back to
+// the scheduler-wide defaults; zero is a setting like any other, so
+// max_retries: 0 turns retries off for the job type.
+type RetryPolicyOverride struct {
+	MaxRetries *int     `yaml:"max_retries"`
+	Delay      *int     `yaml:"delay"`      // seconds
+	Multiplier *float64 `yaml:"multiplier"` // growth per attempt
+	MaxDelay   *int     `yaml:"max_delay"`  // seconds
+	Jitter     *float64 `yaml:"jitter"`     // 0-1
+}
+
+// Location returns the IANA timezone the scheduler interprets cron specs and
+// wall-clock schedule times in. An empty timezone means UTC.
+func (c SchedulerConfig) Location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q: %w", c.Timezone, err)
+	}
+	return loc, nil
+}
+
+// PriorityFor returns the default priority of jobs of the given type.
+func (c SchedulerConfig) PriorityFor(jobType string) int {
+	return c.Priorities[jobType]
+}
+
+// RetryPolicyFor returns the effective retry policy for a job type, merging
+// any per-type override over the scheduler defaults.
+func (c SchedulerConfig) RetryPolicyFor(jobType string) RetryPolicy {
+	policy := RetryPolicy{
+		MaxRetries: c.MaxRetries,
+		Delay:      c.RetryDelay,
+		Multiplier: c.RetryMultiplier,
+		MaxDelay:   c.RetryMaxDelay,
+		Jitter:     c.RetryJitter,
+	}
+
+	override, ok := c.RetryPolicies[jobType]
+	if !ok {
+		return policy
+	}
+	if override.MaxRetries != nil {
+		policy.MaxRetries = *override.MaxRetries
+	}
+	if override.Delay != nil {
+		policy.Delay = *override.Delay
+	}
+	if override.Multiplier != nil {
+		policy.Multiplier = *override.Multiplier
+	}
+	if override.MaxDelay != nil {
+		policy.MaxDelay = *override.MaxDelay
+	}
+	if override.Jitter != nil {
+		policy.Jitter = *override.Jitter
+	}
+	return policy
 }
 
 type ProvisioningConfig struct {
@@ -48,13 +155,193 @@ type TerminationConfig struct {
 	RetryDelay    int    `yaml:"retry_delay"` // seconds
 }
 
+// TargetConfig describes the HTTP request made for a job type, as resolved
+// by WebhookTargets.
+type TargetConfig struct {
+	URL           string
+	Method        string            // defaults to POST
+	Timeout       int               // seconds per HTTP request
+	Headers       map[string]string // values may reference ${ENV_VARS}
+	Auth          TargetAuth
+	RetryAttempts int    // HTTP requests per job attempt, including the first
+	RetryDelay    int    // seconds between those requests
+	CompensateURL string // called when a running job of this type is cancelled
+	DryRunURL     string // receives dry-run jobs; without it they are only validated
+}
+
+// TargetOverride is a targets entry. It is merged over the provisioning,
+// termination and webhooks settings for the same job type; fields left out
+// keep the inherited value, and zero is a setting like any other, so
+// retry_attempts: 0 sends a single request.
+type TargetOverride struct {
+	URL           string            `yaml:"url"`
+	Method        string            `yaml:"method"`
+	Timeout       *int              `yaml:"timeout"` // seconds; must be positive
+	Headers       map[string]string `yaml:"headers"`
+	Auth          TargetAuth        `yaml:"auth"`
+	RetryAttempts *int              `yaml:"retry_attempts"`
+	RetryDelay    *int              `yaml:"retry_delay"`
+	CompensateURL string            `yaml:"compensate_url"`
+	DryRunURL     string            `yaml:"dry_run_url"`
+}
+
+// TargetAuth adds credentials to outbound requests. Type is bearer (Token),
+// basic (Username and Password) or header (Token sent in Header). Values may
+// reference ${ENV_VARS}.
+type TargetAuth struct {
+	Type     string `yaml:"type"`
+	Token    string `yaml:"token"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Header   string `yaml:"header"`
+}
+
+// WebhookTargets returns the effective HTTP target for every job type that
+// has one: provision and terminate from their own sections, the rest from
+// webhooks, each with its targets entry merged on top.
+func (c *Config) WebhookTargets() map[string]TargetConfig {
+	targets := map[string]TargetConfig{}
+
+	if c.Provisioning.APIURL != "" {
+		targets["provision"] = TargetConfig{
+			URL:           c.Provisioning.APIURL,
+			Timeout:       c.Provisioning.Timeout,
+			RetryAttempts: c.Provisioning.RetryAttempts,
+			RetryDelay:    c.Provisioning.RetryDelay,
+		}
+	}
+	if c.Termination.APIURL != "" {
+		targets["terminate"] = TargetConfig{
+			URL:           c.Termination.APIURL,
+			Timeout:       c.Termination.Timeout,
+			RetryAttempts: c.Termination.RetryAttempts,
+			RetryDelay:    c.Termination.RetryDelay,
+		}
+	}
+	for jobType, url := range c.Webhooks {
+		if url == "" || jobType == "provision" || jobType == "terminate" {
+			continue
+		}
+		// Plain webhooks historically shared the provisioning timeout.
+		targets[jobType] = TargetConfig{URL: url, Timeout: c.Provisioning.Timeout}
+	}
+
+	for jobType, override := range c.Targets {
+		target, ok := targets[jobType]
+		if !ok {
+			// A job type only configured here gets the same defaults as one
+			// under webhooks.
+			target = TargetConfig{Timeout: c.Provisioning.Timeout}
+		}
+		if override.URL != "" {
+			target.URL = override.URL
+		}
+		if override.Method != "" {
+			target.Method = override.Method
+		}
+		if override.Timeout != nil {
+			target.Timeout = *override.Timeout
+		}
+		if override.RetryAttempts != nil {
+			target.RetryAttempts = *override.RetryAttempts
+		}
+		if override.RetryDelay != nil {
+			target.RetryDelay = *override.RetryDelay
+		}
+		if override.Auth.Type != "" {
+			target.Auth = override.Auth
+		}
+		if override.CompensateURL != "" {
+			target.CompensateURL = override.CompensateURL
+		}
+		if override.DryRunURL != "" {
+			target.DryRunURL = override.DryRunURL
+		}
+		if len(override.Headers) > 0 {
+			headers := make(map[string]string, len(target.Headers)+len(override.Headers))
+			for k, v := range target.Headers {
+				headers[k] = v
+			}
+			for k, v := range override.Headers {
+				headers[k] = v
+			}
+			target.Headers = headers
+		}
+		if target.URL != "" {
+			targets[jobType] = target
+		}
+	}
+
+	for jobType, target := range targets {
+		if target.Method == "" {
+			target.Method = http.MethodPost
+		}
+		target.Method = strings.ToUpper(target.Method)
+		if target.RetryAttempts < 1 {
+			target.RetryAttempts = 1
+		}
+		targets[jobType] = target
+	}
+
+	return targets
+}
+
+// SigningConfig enables HMAC-SHA256 signatures on outbound webhook and
+// directory sync requests. Signing is off while KeyID is empty. To rotate,
+// move the current key to PreviousKeyID and PreviousSecret and set the new
+// one; requests carry both signatures until the previous key is removed.
+type SigningConfig struct {
+	KeyID          string `yaml:"key_id"`          // sent as kid so receivers can pick the secret
+	Secret         string `yaml:"secret"`          // may reference ${ENV_VAR}
+	PreviousKeyID  string `yaml:"previous_key_id"` // optional; key being rotated out
+	PreviousSecret string `yaml:"previous_secret"` // may reference ${ENV_VAR}
+}
+
+// CalendarConfig restricts when job types may execute. Times are read in
+// scheduler.timezone.
+type CalendarConfig struct {
+	Windows          map[string]ExecutionWindow `yaml:"windows"` // per job type
+	Blackouts        []BlackoutConfig           `yaml:"blackouts"`
+	HolidayCalendars []HolidayCalendarConfig    `yaml:"holiday_calendars"`
+}
+
+// ExecutionWindow is a recurring weekly period during which a job type may
+// run, e.g. weekdays 09:00-18:00.
+type ExecutionWindow struct {
+	Days  []string `yaml:"days"`  // mon, tue, ...; empty means every day
+	Start string   `yaml:"start"` // HH:MM
+	End   string   `yaml:"end"`   // HH:MM, exclusive
+}
+
+// BlackoutConfig is a date range during which the listed job types (or all
+// job types, if none are listed) must not run.
+type BlackoutConfig struct {
+	Name     string   `yaml:"name"`
+	Start    string   `yaml:"start"` // 2006-01-02 or 2006-01-02 15:04
+	End      string   `yaml:"end"`   // a bare date includes the whole day
+	JobTypes []string `yaml:"job_types"`
+}
+
+// HolidayCalendarConfig imports blackout days from an iCalendar (.ics) file.
+type HolidayCalendarConfig struct {
+	Path     string   `yaml:"path"`
+	JobTypes []string `yaml:"job_types"`
+}
+
 type DirectorySyncConfig struct {
-	APIURL   string `yaml:"api_url"`   // e.g. http://localhost:3000/api/directory/sync
-	Interval string `yaml:"interval"`  // cron format, e.g. "0 * * * *" (every hour)
-	APIKey   string `yaml:"api_key"`   // internal key to authenticate sync calls
+	APIURL   string `yaml:"api_url"`  // e.g. http://localhost:3000/api/directory/sync
+	Interval string `yaml:"interval"` // cron format, e.g. "0 * * * *" (every hour)
+	APIKey   string `yaml:"api_key"`  // internal key to authenticate sync calls
 	Enabled  bool   `yaml:"enabled"`
 }
 
+// CommandConfig runs a job type as a local command instead of a webhook.
+// The job payload is written to the command's stdin.
+type CommandConfig struct {
+	Command []string `yaml:"command"`
+	Timeout int      `yaml:"timeout"` // seconds
+}
+
 type LoggingConfig struct {
 	Level  string `yaml:"level"`
 	Format string `yaml:"format"`
@@ -67,6 +354,38 @@ type ServerConfig struct {
 
 // Load reads the configuration from a YAML file
 func Load(path string) (*Config, error) {
+	cfg, err := parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate configuration
+	if err := validate(cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// LoadDatabase reads the configuration from a YAML file like Load, but only
+// validates the database settings. It is meant for commands such
+// as `migrate` that never start the scheduler.
+func LoadDatabase(path string) (*Config, error) {
+	cfg, err := parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateDatabase(cfg.Database); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// parse reads and parses a YAML config file and applies the environment
+// overrides, without validating the result.
+func parse(path string) (*Config, error) {
 	// Read file
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -82,11 +401,6 @@ func Load(path string) (*Config, error) {
 	// Override with environment variables
 	overrideWithEnv(&cfg)
 
-	// Validate configuration
-	if err := validate(&cfg); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
-	}
-
 	return &cfg, nil
 }
 
@@ -122,6 +436,27 @@ func overrideWithEnv(cfg *Config) {
 	if interval := os.Getenv("SCHEDULER_INTERVAL"); interval != "" {
 		cfg.Scheduler.CheckInterval = interval
 	}
+	if tz := os.Getenv("SCHEDULER_TIMEZONE"); tz != "" {
+		cfg.Scheduler.Timezone = tz
+	}
+	if workerID := os.Getenv("SCHEDULER_WORKER_ID"); workerID != "" {
+		cfg.Scheduler.WorkerID = workerID
+	}
+	if dryRun := os.Getenv("SCHEDULER_DRY_RUN"); dryRun != "" {
+		cfg.Scheduler.DryRun = dryRun == "true" || dryRun == "1"
+	}
+	if keyID := os.Getenv("WEBHOOK_SIGNING_KEY_ID"); keyID != "" {
+		cfg.Signing.KeyID = keyID
+	}
+	if secret := os.Getenv("WEBHOOK_SIGNING_SECRET"); secret != "" {
+		cfg.Signing.Secret = secret
+	}
+	if keyID := os.Getenv("WEBHOOK_SIGNING_PREVIOUS_KEY_ID"); keyID != "" {
+		cfg.Signing.PreviousKeyID = keyID
+	}
+	if secret := os.Getenv("WEBHOOK_SIGNING_PREVIOUS_SECRET"); secret != "" {
+		cfg.Signing.PreviousSecret = secret
+	}
 	if level := os.Getenv("LOG_LEVEL"); level != "" {
 		cfg.Logging.Level = level
 	}
@@ -129,14 +464,8 @@ func overrideWithEnv(cfg *Config) {
 
 // validate checks if the configuration is valid
 func validate(cfg *Config) error {
-	if cfg.Database.Host == "" {
-		return fmt.Errorf("database host is required")
-	}
-	if cfg.Database.User == "" {
-		return fmt.Errorf("database user is required")
-	}
-	if cfg.Database.DBName == "" {
-		return fmt.Errorf("database name is required")
+	if err := validateDatabase(cfg.Database); err != nil {
+		return err
 	}
 	if cfg.Provisioning.APIURL == "" {
 		return fmt.Errorf("provisioning API URL is required")
@@ -147,5 +476,92 @@ func validate(cfg *Config) error {
 	if cfg.Scheduler.CheckInterval == "" {
 		return fmt.Errorf("scheduler check interval is required")
 	}
+	if _, err := cfg.Scheduler.Location(); err != nil {
+		return fmt.Errorf("scheduler timezone: %w", err)
+	}
+	if cfg.Scheduler.RetryJitter < 0 || cfg.Scheduler.RetryJitter > 1 {
+		return fmt.Errorf("scheduler retry_jitter must be between 0 and 1")
+	}
+	for jobType, command := range cfg.Commands {
+		if len(command.Command) == 0 {
+			return fmt.Errorf("commands.%s: command is required", jobType)
+		}
+	}
+	if cfg.Signing.KeyID != "" && os.ExpandEnv(cfg.Signing.Secret) == "" {
+		return fmt.Errorf("signing secret is required when signing.key_id is set")
+	}
+	if cfg.Signing.PreviousKeyID != "" {
+		if os.ExpandEnv(cfg.Signing.PreviousSecret) == "" {
+			return fmt.Errorf("signing previous_secret is required when signing.previous_key_id is set")
+		}
+		if cfg.Signing.PreviousKeyID == cfg.Signing.KeyID {
+			return fmt.Errorf("signing previous_key_id must differ from key_id")
+		}
+	}
+	for jobType, target := range cfg.Targets {
+		if target.URL == "" && cfg.Webhooks[jobType] == "" && jobType != "provision" && jobType != "terminate" {
+			return fmt.Errorf("targets.%s: url is required", jobType)
+		}
+		if target.Timeout != nil && *target.Timeout <= 0 {
+			return fmt.Errorf("targets.%s: timeout must be positive", jobType)
+		}
+		if target.RetryAttempts != nil && *target.RetryAttempts < 0 {
+			return fmt.Errorf("targets.%s: retry_attempts must not be negative", jobType)
+		}
+		switch strings.ToUpper(target.Method) {
+		case "", http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodGet, http.MethodDelete:
+		default:
+			return fmt.Errorf("targets.%s: unsupported method %q", jobType, target.Method)
+		}
+		switch target.Auth.Type {
+		case "", "bearer", "header":
+			if target.Auth.Type == "header" && target.Auth.Header == "" {
+				return fmt.Errorf("targets.%s: auth header name is required", jobType)
+			}
+		case "basic":
+		default:
+			return fmt.Errorf("targets.%s: unknown auth type %q", jobType, target.Auth.Type)
+		}
+	}
+	for jobType, target := range cfg.WebhookTargets() {
+		// Without a timeout a hung target would hold a worker and its lease
+		// forever.
+		if target.Timeout <= 0 {
+			return fmt.Errorf("webhook target %s has no timeout; set provisioning.timeout or targets.%s.timeout", jobType, jobType)
+		}
+	}
+	for jobType, limit := range cfg.Scheduler.Concurrency {
+		if limit < 0 {
+			return fmt.Errorf("scheduler concurrency for %s must not be negative", jobType)
+		}
+	}
+	if cfg.Scheduler.ReservedWorkers < 0 {
+		return fmt.Errorf("scheduler reserved_workers must not be negative")
+	}
+	if cfg.Scheduler.Workers > 0 && cfg.Scheduler.ReservedWorkers >= cfg.Scheduler.Workers {
+		return fmt.Errorf("scheduler reserved_workers must be less than workers")
+	}
+	for jobType, policy := range cfg.Scheduler.RetryPolicies {
+		if policy.MaxRetries != nil && *policy.MaxRetries < 0 {
+			return fmt.Errorf("retry_policies.%s max_retries must not be negative", jobType)
+		}
+		if policy.Jitter != nil && (*policy.Jitter < 0 || *policy.Jitter > 1) {
+			return fmt.Errorf("retry_policies.%s jitter must be between 0 and 1", jobType)
+		}
+	}
+	return nil
+}
+
+// validateDatabase checks the settings needed to connect to the database
+func validateDatabase(db DatabaseConfig) error {
+	if db.Host == "" {
+		return fmt.Errorf("database host is required")
+	}
+	if db.User == "" {
+		return fmt.Errorf("database user is required")
+	}
+	if db.DBName == "" {
+		return fmt.Errorf("database name is required")
+	}
 	return nil
 }
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRetryPolicyFor(t *testing.T) {
+	var cfg SchedulerConfig
+	err := yaml.Unmarshal([]byte(`
+max_retries: 3
+retry_delay: 300
+retry_multiplier: 2
+retry_max_delay: 3600
+retry_jitter: 0.2
+retry_policies:
+  terminate:
+    max_retries: 0
+  modify_license:
+    delay: 600
+    max_delay: 0
+    jitter: 0
+  provision: {}
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := RetryPolicy{MaxRetries: 3, Delay: 300, Multiplier: 2, MaxDelay: 3600, Jitter: 0.2}
+	tests := []struct {
+		jobType string
+		want    RetryPolicy
+	}{
+		{jobType: "suspend", want: defaults},
+		{jobType: "provision", want: defaults},
+		{jobType: "terminate", want: RetryPolicy{MaxRetries: 0, Delay: 300, Multiplier: 2, MaxDelay: 3600, Jitter: 0.2}},
+		{jobType: "modify_license", want: RetryPolicy{MaxRetries: 3, Delay: 600, Multiplier: 2, MaxDelay: 0, Jitter: 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.jobType, func(t *testing.T) {
+			if got := cfg.RetryPolicyFor(tt.jobType); got != tt.want {
+				t.Errorf("RetryPolicyFor(%q) = %+v, want %+v", tt.jobType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookTargets(t *testing.T) {
+	var cfg Config
+	err := yaml.Unmarshal([]byte(`
+provisioning:
+  api_url: http://n8n/provision
+  timeout: 300
+  retry_attempts: 3
+  retry_delay: 5
+termination:
+  api_url: http://n8n/terminate
+  timeout: 120
+  retry_attempts: 3
+webhooks:
+  suspend: http://n8n/suspend
+targets:
+  terminate:
+    retry_attempts: 0
+    method: put
+  suspend:
+    timeout: 30
+    headers:
+      X-Source: scheduler
+  password_reset:
+    url: http://n8n/password-reset
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]TargetConfig{
+		"provision":      {URL: "http://n8n/provision", Method: "POST", Timeout: 300, RetryAttempts: 3, RetryDelay: 5},
+		"terminate":      {URL: "http://n8n/terminate", Method: "PUT", Timeout: 120, RetryAttempts: 1},
+		"suspend":        {URL: "http://n8n/suspend", Method: "POST", Timeout: 30, RetryAttempts: 1, Headers: map[string]string{"X-Source": "scheduler"}},
+		"password_reset": {URL: "http://n8n/password-reset", Method: "POST", Timeout: 300, RetryAttempts: 1},
+	}
+
+	got := cfg.WebhookTargets()
+	if len(got) != len(want) {
+		t.Fatalf("WebhookTargets() returned %d targets, want %d: %+v", len(got), len(want), got)
+	}
+	for jobType, w := range want {
+		g, ok := got[jobType]
+		if !ok {
+			t.Errorf("no target for %s", jobType)
+			continue
+		}
+		if g.URL != w.URL || g.Method != w.Method || g.Timeout != w.Timeout ||
+			g.RetryAttempts != w.RetryAttempts || g.RetryDelay != w.RetryDelay ||
+			len(g.Headers) != len(w.Headers) || g.Headers["X-Source"] != w.Headers["X-Source"] {
+			t.Errorf("target %s = %+v, want %+v", jobType, g, w)
+		}
+	}
+}
+
+func TestValidateTargets(t *testing.T) {
+	base := `
+database: {host: db, user: scheduler, dbname: scheduler}
+scheduler: {check_interval: "@every 1m"}
+provisioning: {api_url: http://n8n/provision, timeout: 300}
+termination: {api_url: http://n8n/terminate, timeout: 300}
+`
+	tests := []struct {
+		name    string
+		extra   string
+		wantErr bool
+	}{
+		{name: "inherited timeouts", extra: "targets: {password_reset: {url: http://n8n/reset}}"},
+		{name: "zero timeout", extra: "targets: {terminate: {timeout: 0}}", wantErr: true},
+		{name: "negative retry attempts", extra: "targets: {terminate: {retry_attempts: -1}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			if err := yaml.Unmarshal([]byte(base), &cfg); err != nil {
+				t.Fatal(err)
+			}
+			if err := yaml.Unmarshal([]byte(tt.extra), &cfg); err != nil {
+				t.Fatal(err)
+			}
+			err := validate(&cfg)
+			if tt.wantErr && err == nil {
+				t.Fatal("validate() succeeded, want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("validate() error: %v", err)
+			}
+		})
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(base), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Provisioning.Timeout = 0
+	if err := validate(&cfg); err == nil {
+		t.Error("validate() accepted a provisioning target without a timeout")
+	}
+}
+
+func TestLoadDatabase(t *testing.T) {
+	for _, env := range []string{"DATABASE_HOST", "DATABASE_USER", "DATABASE_NAME", "PROVISIONING_API_URL", "TERMINATION_API_URL", "SCHEDULER_INTERVAL"} {
+		t.Setenv(env, "")
+	}
+
+	write := func(content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	dbOnly := write("database: {host: db, user: scheduler, dbname: scheduler}\n")
+	cfg, err := LoadDatabase(dbOnly)
+	if err != nil {
+		t.Fatalf("LoadDatabase() error: %v", err)
+	}
+	if cfg.Database.Host != "db" {
+		t.Errorf("Database.Host = %q, want %q", cfg.Database.Host, "db")
+	}
+	if _, err := Load(dbOnly); err == nil {
+		t.Error("Load() accepted a config without provisioning and scheduler settings")
+	}
+
+	if _, err := LoadDatabase(write("database: {user: scheduler, dbname: scheduler}\n")); err == nil {
+		t.Error("LoadDatabase() accepted a config without a database host")
+	}
+
+	t.Setenv("DATABASE_HOST", "db-from-env")
+	cfg, err = LoadDatabase(write("database: {user: scheduler, dbname: scheduler}\n"))
+	if err != nil {
+		t.Fatalf("LoadDatabase() error: %v", err)
+	}
+	if cfg.Database.Host != "db-from-env" {
+		t.Errorf("Database.Host = %q, want the DATABASE_HOST override", cfg.Database.Host)
+	}
+}
@@ -1,12 +1,17 @@
 package database
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/mfellsbbtv/oneclick-scheduler/pkg/config"
 	log "github.com/sirupsen/logrus"
 )
@@ -14,8 +19,52 @@ import (
 // DB wraps the database connection
 type DB struct {
 	*sql.DB
+	dsn string
 }
 
+// WakeupChannel is the Postgres NOTIFY channel on which schedule changes are
+// announced, so schedulers can react without waiting for the next poll.
+const WakeupChannel = "scheduler_wakeup"
+
+// ErrDuplicateIdempotencyKey is returned when a job is created with an
+// idempotency key that another job already holds.
+var ErrDuplicateIdempotencyKey = errors.New("idempotency key already used")
+
+// ErrJobNotCancellable is returned when a job does not exist or has already
+// finished.
+var ErrJobNotCancellable = errors.New("job not found or already finished")
+
+// ErrCancelRequested is returned by RenewJobLease once someone has asked for
+// the job to be cancelled; the lease is still renewed. The calls that release
+// an executing job return it instead of releasing the job, so the worker can
+// finish the cancellation.
+var ErrCancelRequested = errors.New("job cancellation requested")
+
+// ErrJobNotEditable is returned when a job is edited after it left pending.
+var ErrJobNotEditable = errors.New("job is not pending")
+
+// ErrStaleJob is returned when a job was modified since the version the
+// caller based its edit on.
+var ErrStaleJob = errors.New("job was modified since it was read")
+
+// ErrUnknownDependency is returned when a job depends on a job that does not
+// exist.
+var ErrUnknownDependency = errors.New("dependency does not exist")
+
+// ErrPlanCancelled is returned when acting on a plan that was cancelled.
+var ErrPlanCancelled = errors.New("plan was cancelled")
+
+// ErrJobNotReplayable is returned when replaying a job that has not failed.
+var ErrJobNotReplayable = errors.New("only failed jobs can be replayed")
+
+// ErrAlreadyReplayed is returned when replaying a job that was replayed
+// before.
+var ErrAlreadyReplayed = errors.New("job was already replayed")
+
+// ErrJobNotClaimed is returned when a worker tries to finish a job it no
+// longer holds the claim for (e.g. the row was reclaimed by another worker).
+var ErrJobNotClaimed = errors.New("job is not claimed by this worker")
+
 // Connect establishes a connection to the database
 func Connect(cfg config.DatabaseConfig) (*DB, error) {
 	sslMode := cfg.SSLMode
@@ -43,179 +92,7 @@ func Connect(cfg config.DatabaseConfig) (*DB, error) {
 	db.SetMaxIdleConns(5)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
-	return &DB{db}, nil
-}
-
-// RunMigrations runs database migrations
-func RunMigrations(db *DB) error {
-	query := `
-	CREATE TABLE IF NOT EXISTS scheduled_provisions (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		employee_data JSONB NOT NULL,
-		applications JSONB NOT NULL,
-		schedule_time TIMESTAMP WITH TIME ZONE NOT NULL,
-		status VARCHAR(50) NOT NULL DEFAULT 'pending',
-		tags TEXT[] NOT NULL,
-		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-		updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-		executed_at TIMESTAMP WITH TIME ZONE,
-		error_message TEXT,
-		retry_count INTEGER DEFAULT 0,
-		CONSTRAINT valid_status CHECK (status IN ('pending', 'executing', 'completed', 'failed', 'cancelled'))
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_schedule_time ON scheduled_provisions(schedule_time) WHERE status = 'pending';
-	CREATE INDEX IF NOT EXISTS idx_tags ON scheduled_provisions USING GIN(tags);
-	CREATE INDEX IF NOT EXISTS idx_status ON scheduled_provisions(status);
-	`
-
-	_, err := db.Exec(query)
-	if err != nil {
-		return fmt.Errorf("failed to run migrations: %w", err)
-	}
-
-	// Second migration: extend table to support generic job types
-	migrationV2 := `
-	ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS job_type VARCHAR(20) NOT NULL DEFAULT 'provision';
-	ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS payload JSONB;
-	ALTER TABLE scheduled_provisions DROP CONSTRAINT IF EXISTS valid_job_type;
-	ALTER TABLE scheduled_provisions ADD CONSTRAINT valid_job_type CHECK (job_type IN ('provision', 'terminate'));
-	CREATE INDEX IF NOT EXISTS idx_job_type ON scheduled_provisions(job_type);
-	`
-
-	_, err = db.Exec(migrationV2)
-	if err != nil {
-		return fmt.Errorf("failed to run v2 migrations: %w", err)
-	}
-
-	// Third migration: expand job types, add approval and target user tracking
-	migrationV3 := `
-	ALTER TABLE scheduled_provisions DROP CONSTRAINT IF EXISTS valid_job_type;
-	ALTER TABLE scheduled_provisions ADD CONSTRAINT valid_job_type CHECK (
-		job_type IN (
-			'provision', 'terminate', 'suspend', 'reactivate',
-			'modify_groups', 'modify_license', 'modify_role',
-			'password_reset', 'transfer_ownership'
-		)
-	);
-	ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS target_user_email VARCHAR(255);
-	ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS requested_by VARCHAR(255);
-	ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS approved_by VARCHAR(255);
-	ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS approval_status VARCHAR(20) DEFAULT 'auto_approved';
-	ALTER TABLE scheduled_provisions DROP CONSTRAINT IF EXISTS valid_approval_status;
-	ALTER TABLE scheduled_provisions ADD CONSTRAINT valid_approval_status CHECK (
-		approval_status IN ('pending_approval', 'approved', 'rejected', 'auto_approved')
-	);
-	CREATE INDEX IF NOT EXISTS idx_approval_status ON scheduled_provisions(approval_status) WHERE approval_status = 'pending_approval';
-	CREATE INDEX IF NOT EXISTS idx_target_user ON scheduled_provisions(target_user_email);
-	`
-
-	_, err = db.Exec(migrationV3)
-	if err != nil {
-		return fmt.Errorf("failed to run v3 migrations: %w", err)
-	}
-
-	// Fourth migration: managed_users, directory sync, and change requests tables
-	migrationV4 := `
-	CREATE TABLE IF NOT EXISTS managed_users (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		email VARCHAR(255) NOT NULL UNIQUE,
-		full_name VARCHAR(255) NOT NULL,
-		given_name VARCHAR(128),
-		family_name VARCHAR(128),
-		department VARCHAR(255),
-		job_title VARCHAR(255),
-		manager_email VARCHAR(255),
-		org_unit_path VARCHAR(512),
-		is_admin BOOLEAN DEFAULT false,
-		is_delegated_admin BOOLEAN DEFAULT false,
-		is_suspended BOOLEAN DEFAULT false,
-		google_id VARCHAR(255) UNIQUE,
-		status VARCHAR(50) NOT NULL DEFAULT 'active',
-		metadata JSONB DEFAULT '{}'::jsonb,
-		last_synced_at TIMESTAMP WITH TIME ZONE,
-		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-		updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-	);
-	CREATE INDEX IF NOT EXISTS idx_managed_users_email ON managed_users(email);
-	CREATE INDEX IF NOT EXISTS idx_managed_users_status ON managed_users(status);
-	CREATE INDEX IF NOT EXISTS idx_managed_users_department ON managed_users(department);
-	CREATE INDEX IF NOT EXISTS idx_managed_users_google_id ON managed_users(google_id);
-
-	CREATE TABLE IF NOT EXISTS user_app_accounts (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		managed_user_id UUID NOT NULL REFERENCES managed_users(id) ON DELETE CASCADE,
-		app_provider VARCHAR(50) NOT NULL,
-		status VARCHAR(50) NOT NULL DEFAULT 'not_provisioned',
-		external_user_id VARCHAR(255),
-		external_email VARCHAR(255),
-		license_info JSONB DEFAULT '[]'::jsonb,
-		groups_info JSONB DEFAULT '[]'::jsonb,
-		role_info JSONB DEFAULT '{}'::jsonb,
-		metadata JSONB DEFAULT '{}'::jsonb,
-		provisioned_at TIMESTAMP WITH TIME ZONE,
-		last_modified_at TIMESTAMP WITH TIME ZONE,
-		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-		updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-		UNIQUE(managed_user_id, app_provider)
-	);
-	CREATE INDEX IF NOT EXISTS idx_user_app_accounts_user ON user_app_accounts(managed_user_id);
-	CREATE INDEX IF NOT EXISTS idx_user_app_accounts_provider ON user_app_accounts(app_provider);
-
-	CREATE TABLE IF NOT EXISTS directory_sync_runs (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		status VARCHAR(20) NOT NULL DEFAULT 'running',
-		users_synced INTEGER DEFAULT 0,
-		users_added INTEGER DEFAULT 0,
-		users_updated INTEGER DEFAULT 0,
-		users_removed INTEGER DEFAULT 0,
-		errors JSONB DEFAULT '[]'::jsonb,
-		started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-		completed_at TIMESTAMP WITH TIME ZONE
-	);
-	CREATE INDEX IF NOT EXISTS idx_sync_runs_started ON directory_sync_runs(started_at DESC);
-
-	CREATE TABLE IF NOT EXISTS change_requests (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		request_type VARCHAR(30) NOT NULL,
-		target_user_email VARCHAR(255) NOT NULL,
-		target_user_name VARCHAR(255),
-		payload JSONB NOT NULL,
-		schedule_time TIMESTAMP WITH TIME ZONE,
-		status VARCHAR(20) NOT NULL DEFAULT 'pending_approval',
-		requested_by VARCHAR(255) NOT NULL,
-		requested_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-		approved_by VARCHAR(255),
-		approved_at TIMESTAMP WITH TIME ZONE,
-		executed_at TIMESTAMP WITH TIME ZONE,
-		error_message TEXT,
-		retry_count INTEGER DEFAULT 0,
-		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-		updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-	);
-	CREATE INDEX IF NOT EXISTS idx_cr_status ON change_requests(status);
-	CREATE INDEX IF NOT EXISTS idx_cr_type ON change_requests(request_type);
-	CREATE INDEX IF NOT EXISTS idx_cr_target ON change_requests(target_user_email);
-	CREATE INDEX IF NOT EXISTS idx_cr_requested_by ON change_requests(requested_by);
-
-	CREATE TABLE IF NOT EXISTS approval_actions (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		change_request_id UUID NOT NULL REFERENCES change_requests(id) ON DELETE CASCADE,
-		action VARCHAR(10) NOT NULL,
-		actor_email VARCHAR(255) NOT NULL,
-		reason TEXT,
-		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-	);
-	CREATE INDEX IF NOT EXISTS idx_approval_actions_request ON approval_actions(change_request_id);
-	`
-
-	_, err = db.Exec(migrationV4)
-	if err != nil {
-		return fmt.Errorf("failed to run v4 migrations: %w", err)
-	}
-
-	log.Info("Database migrations completed successfully")
-	return nil
+	return &DB{DB: db, dsn: dsn}, nil
 }
 
 // CreateScheduledProvision inserts a new scheduled provision
@@ -254,6 +131,8 @@ func (db *DB) CreateScheduledProvision(sp *ScheduledProvision) error {
 		"schedule_time": sp.ScheduleTime,
 	}).Info("Created scheduled provision")
 
+	db.notifyWakeup("scheduled_provisions", sp.ID)
+
 	return nil
 }
 
@@ -472,9 +351,39 @@ func (db *DB) CancelProvision(id uuid.UUID) error {
 
 // ---- Generic ScheduledJob methods ----
 
-// CreateScheduledJob inserts a new generic scheduled job.
+// CreateScheduledJob inserts a new generic scheduled job together with its
+// dependencies.
 func (db *DB) CreateScheduledJob(job *ScheduledJob) error {
-	job.ID = uuid.New()
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err := insertJob(tx, job); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit scheduled job: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"id":            job.ID,
+		"job_type":      job.JobType,
+		"schedule_time": job.ScheduleTime,
+	}).Info("Created scheduled job")
+
+	db.notifyWakeup("scheduled_provisions", job.ID)
+
+	return nil
+}
+
+// insertJob inserts job and its dependencies within tx. A job that already
+// has an ID keeps it, so plan steps can refer to each other before insert.
+func insertJob(tx *sql.Tx, job *ScheduledJob) error {
+	if job.ID == uuid.Nil {
+		job.ID = uuid.New()
+	}
 	job.CreatedAt = time.Now()
 	job.UpdatedAt = time.Now()
 	job.Status = StatusPending
@@ -487,11 +396,14 @@ func (db *DB) CreateScheduledJob(job *ScheduledJob) error {
 		INSERT INTO scheduled_provisions (
 			id, job_type, payload, schedule_time, status, tags,
 			target_user_email, requested_by, approved_by, approval_status,
-			created_at, updated_at, retry_count
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			created_at, updated_at, retry_count, idempotency_key, request_hash, dry_run,
+			plan_id, plan_step, replayed_from, replayed_by, priority, batch_id,
+			template_name, template_version
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20,
+			$21, $22, $23, $24)
 	`
 
-	_, err := db.Exec(query,
+	_, err := tx.Exec(query,
 		job.ID,
 		job.JobType,
 		job.Payload,
@@ -505,16 +417,40 @@ func (db *DB) CreateScheduledJob(job *ScheduledJob) error {
 		job.CreatedAt,
 		job.UpdatedAt,
 		job.RetryCount,
+		job.IdempotencyKey,
+		job.RequestHash,
+		job.DryRun,
+		job.PlanID,
+		job.PlanStep,
+		job.ReplayedFrom,
+		job.ReplayedBy,
+		job.Priority,
+		job.BatchID,
+		job.TemplateName,
+		job.TemplateVersion,
 	)
+	if isUniqueViolation(err, "idx_idempotency_key") {
+		return ErrDuplicateIdempotencyKey
+	}
+	if isUniqueViolation(err, "idx_replayed_from") {
+		return ErrAlreadyReplayed
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create scheduled job: %w", err)
 	}
 
-	log.WithFields(log.Fields{
-		"id":            job.ID,
-		"job_type":      job.JobType,
-		"schedule_time": job.ScheduleTime,
-	}).Info("Created scheduled job")
+	for _, dependsOn := range job.DependsOn {
+		_, err := tx.Exec(`
+			INSERT INTO job_dependencies (job_id, depends_on) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, job.ID, dependsOn)
+		if isForeignKeyViolation(err) {
+			return fmt.Errorf("%w: %s", ErrUnknownDependency, dependsOn)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record job dependency: %w", err)
+		}
+	}
 
 	return nil
 }
@@ -522,7 +458,28 @@ func (db *DB) CreateScheduledJob(job *ScheduledJob) error {
 // jobColumns is the standard column list for ScheduledJob queries.
 const jobColumns = `id, job_type, payload, schedule_time, status, tags,
 	target_user_email, requested_by, approved_by, approval_status,
-	created_at, updated_at, executed_at, error_message, retry_count`
+	created_at, updated_at, executed_at, error_message, retry_count,
+	claimed_by, lease_expires_at, next_attempt_at, deferred_reason,
+	idempotency_key, request_hash, callback_token, callback_deadline, callback_result,
+	cancel_requested_at, cancelled_by, cancelled_at, dry_run, plan_id, plan_step,
+	ARRAY(SELECT d.depends_on FROM job_dependencies d WHERE d.job_id = scheduled_provisions.id),
+	recurring_job_id, failure_reason, replayed_from, replayed_by,
+	(SELECT r.id FROM scheduled_provisions r WHERE r.replayed_from = scheduled_provisions.id),
+	priority, batch_id, template_name, template_version`
+
+// isUniqueViolation reports whether err is a Postgres unique violation on
+// the named constraint or index.
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+// isForeignKeyViolation reports whether err is a Postgres foreign key
+// violation.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
 
 // scanJob scans a ScheduledJob from a row.
 func scanJob(scan func(dest ...interface{}) error) (ScheduledJob, error) {
@@ -531,20 +488,25 @@ func scanJob(scan func(dest ...interface{}) error) (ScheduledJob, error) {
 		&j.ID, &j.JobType, &j.Payload, &j.ScheduleTime, &j.Status, &j.Tags,
 		&j.TargetUserEmail, &j.RequestedBy, &j.ApprovedBy, &j.ApprovalStatus,
 		&j.CreatedAt, &j.UpdatedAt, &j.ExecutedAt, &j.ErrorMessage, &j.RetryCount,
+		&j.ClaimedBy, &j.LeaseExpiresAt, &j.NextAttemptAt, &j.DeferredReason,
+		&j.IdempotencyKey, &j.RequestHash, &j.CallbackToken, &j.CallbackDeadline, &j.CallbackResult,
+		&j.CancelRequestedAt, &j.CancelledBy, &j.CancelledAt, &j.DryRun, &j.PlanID, &j.PlanStep,
+		pq.Array(&j.DependsOn), &j.RecurringJobID, &j.FailureReason, &j.ReplayedFrom, &j.ReplayedBy,
+		&j.ReplayedAs, &j.Priority, &j.BatchID, &j.TemplateName, &j.TemplateVersion,
 	)
 	return j, err
 }
 
-// GetPendingJobs returns all pending jobs whose schedule_time has arrived
-// and whose approval_status allows execution.
+// GetPendingJobs returns all pending jobs whose schedule_time has arrived,
+// whose retry backoff has elapsed, and whose approval_status allows execution,
+// highest priority first.
 func (db *DB) GetPendingJobs() ([]ScheduledJob, error) {
 	query := fmt.Sprintf(`
 		SELECT %s
 		FROM scheduled_provisions
-		WHERE status = $1 AND schedule_time <= NOW()
-		  AND approval_status IN ('approved', 'auto_approved')
-		ORDER BY schedule_time ASC
-	`, jobColumns)
+		WHERE %s
+		ORDER BY priority DESC, schedule_time ASC
+	`, jobColumns, dueJobFilter)
 
 	rows, err := db.Query(query, StatusPending)
 	if err != nil {
@@ -564,95 +526,377 @@ func (db *DB) GetPendingJobs() ([]ScheduledJob, error) {
 	return jobs, nil
 }
 
-// GetJobByID retrieves a generic job by its UUID.
-func (db *DB) GetJobByID(id uuid.UUID) (*ScheduledJob, error) {
-	query := fmt.Sprintf(`SELECT %s FROM scheduled_provisions WHERE id = $1`, jobColumns)
+// dueJobFilter matches pending jobs that are ready to run now: scheduled,
+// past any retry backoff, approved, not paused, not asked to be cancelled,
+// and not waiting on dependencies. It expects $1 to be StatusPending.
+const dueJobFilter = `status = $1 AND schedule_time <= NOW()
+	AND (next_attempt_at IS NULL OR next_attempt_at <= NOW())
+	AND cancel_requested_at IS NULL
+	AND approval_status IN ('approved', 'auto_approved')
+	AND NOT EXISTS (SELECT 1 FROM scheduler_pauses p WHERE p.scope IN ('*', job_type))
+	AND ` + dependencyFilter
+
+// dependencyFilter matches jobs whose dependencies have all completed and
+// whose plan, if any, has no failed step. The job's row must be reachable as
+// scheduled_provisions.
+const dependencyFilter = `NOT EXISTS (
+		SELECT 1 FROM job_dependencies d
+		JOIN scheduled_provisions dep ON dep.id = d.depends_on
+		WHERE d.job_id = scheduled_provisions.id
+		  AND dep.status NOT IN ('completed', 'completed_dry_run')
+	)
+	AND (scheduled_provisions.plan_id IS NULL OR NOT EXISTS (
+		SELECT 1 FROM scheduled_provisions failed
+		WHERE failed.plan_id = scheduled_provisions.plan_id AND failed.status = 'failed'
+		  AND NOT EXISTS (SELECT 1 FROM scheduled_provisions r WHERE r.replayed_from = failed.id)
+	))`
+
+// ClaimOptions bounds how many jobs a single ClaimPendingJobs call takes.
+type ClaimOptions struct {
+	// Limit caps the total number of jobs claimed. Zero or less means no cap.
+	Limit int
+	// TypeLimits caps the number of jobs claimed per job type. Types that
+	// are not listed are only bounded by Limit.
+	TypeLimits map[string]int
+	// ReservedSlots of Limit may only be taken by jobs whose priority is at
+	// least UrgentPriority.
+	ReservedSlots  int
+	UrgentPriority int
+}
 
-	j, err := scanJob(db.QueryRow(query, id).Scan)
-	if err == sql.ErrNoRows {
-		return nil, nil
+// ClaimPendingJobs atomically moves due, approved jobs from pending to
+// executing and stamps them with the worker ID and a lease expiry. Rows
+// locked by a concurrent claimer are skipped, so two scheduler replicas never
+// receive the same job.
+//
+// Higher priority jobs are claimed first. Within a priority, requesters take
+// turns: each requester's oldest due job comes before anyone's second, so a
+// bulk import cannot starve jobs requested by others.
+func (db *DB) ClaimPendingJobs(workerID string, lease time.Duration, opts ClaimOptions) ([]ScheduledJob, error) {
+	typeLimits, err := json.Marshal(opts.TypeLimits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode type limits: %w", err)
+	}
+
+	args := []interface{}{StatusPending, StatusExecuting, workerID, lease.Seconds(), string(typeLimits)}
+
+	// Rank due jobs by turn within their requester and priority, then within
+	// their type so per-type caps can be applied, then across the queue so
+	// reserved slots can be kept for urgent jobs, all in the same statement
+	// that locks them. The status check is repeated on the locked row so a
+	// job claimed by a concurrent transaction is re-evaluated and dropped.
+	claimable := fmt.Sprintf(`
+		SELECT sp.id AS claim_id, due.queue_rank FROM scheduled_provisions sp
+		JOIN (
+			SELECT id, priority,
+			       ROW_NUMBER() OVER (ORDER BY priority DESC, requester_rank, schedule_time) AS queue_rank
+			FROM (
+				SELECT id, job_type, priority, schedule_time, requester_rank,
+				       ROW_NUMBER() OVER (
+				           PARTITION BY job_type ORDER BY priority DESC, requester_rank, schedule_time
+				       ) AS type_rank
+				FROM (
+					SELECT id, job_type, priority, schedule_time,
+					       ROW_NUMBER() OVER (
+					           PARTITION BY priority, COALESCE(requested_by, '') ORDER BY schedule_time ASC
+					       ) AS requester_rank
+					FROM scheduled_provisions
+					WHERE %s
+				) fair
+			) typed
+			WHERE type_rank <= COALESCE(($5::jsonb ->> job_type)::int, type_rank)
+		) due ON due.id = sp.id
+		WHERE sp.status = $1`, dueJobFilter)
+	if opts.Limit > 0 && opts.ReservedSlots > 0 {
+		normalLimit := opts.Limit - opts.ReservedSlots
+		if normalLimit < 0 {
+			normalLimit = 0
+		}
+		args = append(args, opts.UrgentPriority, normalLimit)
+		claimable += fmt.Sprintf(" AND (due.priority >= $%d OR due.queue_rank <= $%d)", len(args)-1, len(args))
 	}
+	claimable += " ORDER BY due.queue_rank"
+	if opts.Limit > 0 {
+		args = append(args, opts.Limit)
+		claimable += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	claimable += " FOR UPDATE OF sp SKIP LOCKED"
+
+	query := fmt.Sprintf(`
+		WITH claimable AS (%s)
+		UPDATE scheduled_provisions
+		SET status = $2, claimed_by = $3,
+		    lease_expires_at = NOW() + $4 * INTERVAL '1 second',
+		    updated_at = NOW()
+		FROM claimable
+		WHERE status = $1 AND id = claimable.claim_id
+		RETURNING %s, claimable.queue_rank
+	`, claimable, jobColumns)
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get job: %w", err)
+		return nil, fmt.Errorf("failed to claim pending jobs: %w", err)
 	}
+	defer rows.Close()
 
-	return &j, nil
+	var jobs []ScheduledJob
+	ranks := map[uuid.UUID]int64{}
+	for rows.Next() {
+		var rank int64
+		j, err := scanJob(func(dest ...interface{}) error {
+			return rows.Scan(append(dest, &rank)...)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, j)
+		ranks[j.ID] = rank
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim pending jobs: %w", err)
+	}
+
+	// RETURNING does not preserve the subquery ordering, so restore the
+	// queue rank, which keeps requesters interleaved.
+	sort.Slice(jobs, func(a, b int) bool { return ranks[jobs[a].ID] < ranks[jobs[b].ID] })
+
+	return jobs, nil
 }
 
-// ListJobs lists jobs with optional filters.
-func (db *DB) ListJobs(status *string, tag *string, jobType *string, limit int, offset int) ([]ScheduledJob, error) {
-	query := fmt.Sprintf(`SELECT %s FROM scheduled_provisions WHERE 1=1`, jobColumns)
+// CountDueJobs returns the number of jobs waiting to be claimed, by job type.
+func (db *DB) CountDueJobs() (map[string]int, error) {
+	query := fmt.Sprintf(`
+		SELECT job_type, COUNT(*) FROM scheduled_provisions
+		WHERE %s
+		GROUP BY job_type
+	`, dueJobFilter)
 
-	args := []interface{}{}
-	argCount := 0
+	rows, err := db.Query(query, StatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count due jobs: %w", err)
+	}
+	defer rows.Close()
 
-	if status != nil {
-		argCount++
-		query += fmt.Sprintf(" AND status = $%d", argCount)
-		args = append(args, *status)
+	counts := map[string]int{}
+	for rows.Next() {
+		var jobType string
+		var count int
+		if err := rows.Scan(&jobType, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan due job count: %w", err)
+		}
+		counts[jobType] = count
 	}
 
-	if tag != nil {
-		argCount++
-		query += fmt.Sprintf(" AND $%d = ANY(tags)", argCount)
-		args = append(args, *tag)
+	return counts, nil
+}
+
+// NextDueTime returns the earliest future time at which a pending job or an
+// approved change request becomes due, or nil if nothing is waiting.
+func (db *DB) NextDueTime() (*time.Time, error) {
+	var next sql.NullTime
+	err := db.QueryRow(`
+		SELECT MIN(due) FROM (
+			SELECT GREATEST(schedule_time, COALESCE(next_attempt_at, schedule_time)) AS due
+			FROM scheduled_provisions
+			WHERE status = $1 AND approval_status IN ('approved', 'auto_approved')
+			UNION ALL
+			SELECT GREATEST(schedule_time, COALESCE(next_attempt_at, schedule_time))
+			FROM change_requests
+			WHERE status = $2 AND schedule_time IS NOT NULL
+		) upcoming
+		WHERE due > NOW()
+	`, StatusPending, CRStatusApproved).Scan(&next)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query next due time: %w", err)
+	}
+	if !next.Valid {
+		return nil, nil
 	}
+	return &next.Time, nil
+}
 
-	if jobType != nil {
-		argCount++
-		query += fmt.Sprintf(" AND job_type = $%d", argCount)
-		args = append(args, *jobType)
+// NewListener opens a dedicated connection subscribed to WakeupChannel.
+// The listener reconnects on its own; a nil notification on its Notify
+// channel means the connection was re-established and events may have been
+// missed.
+func (db *DB) NewListener(onEvent pq.EventCallbackType) (*pq.Listener, error) {
+	listener := pq.NewListener(db.dsn, 10*time.Second, time.Minute, onEvent)
+	if err := listener.Listen(WakeupChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", WakeupChannel, err)
+	}
+	return listener, nil
+}
+
+// notifyWakeup tells listening schedulers that a row in table may have
+// become due sooner than they expect. Delivery is best effort: schedulers
+// still poll, so a lost notification only costs latency.
+func (db *DB) notifyWakeup(table string, id uuid.UUID) {
+	db.notify(id, fmt.Sprintf(`{"table":%q,"id":%q}`, table, id.String()))
+}
+
+// notifyCancel tells the worker executing a job that it was cancelled, so it
+// need not wait for its next heartbeat to find out.
+func (db *DB) notifyCancel(id uuid.UUID) {
+	db.notify(id, fmt.Sprintf(`{"table":"scheduled_provisions","id":%q,"event":"cancel"}`, id.String()))
+}
+
+func (db *DB) notify(id uuid.UUID, payload string) {
+	if _, err := db.Exec(`SELECT pg_notify($1, $2)`, WakeupChannel, payload); err != nil {
+		log.WithField("id", id).Warnf("Failed to notify schedulers: %v", err)
 	}
+}
 
-	query += " ORDER BY schedule_time DESC"
+// Pause stops claiming due jobs in scope (PauseAll or a job type) until
+// Resume is called. Pausing an already paused scope updates its reason.
+func (db *DB) Pause(scope, reason, actor string) (*Pause, error) {
+	p := Pause{Scope: scope, Reason: reason, PausedBy: actor}
+	err := db.QueryRow(`
+		INSERT INTO scheduler_pauses (scope, reason, paused_by, paused_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (scope) DO UPDATE SET reason = EXCLUDED.reason, paused_by = EXCLUDED.paused_by
+		RETURNING paused_at
+	`, scope, reason, actor).Scan(&p.PausedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pause %s: %w", scope, err)
+	}
 
-	if limit > 0 {
-		argCount++
-		query += fmt.Sprintf(" LIMIT $%d", argCount)
-		args = append(args, limit)
+	db.recordPauseEvent(scope, "pause", actor, reason)
+	log.WithFields(log.Fields{
+		"scope":  scope,
+		"actor":  actor,
+		"reason": reason,
+	}).Warn("Paused job execution")
+
+	return &p, nil
+}
+
+// Resume lifts the pause on scope. It returns false if scope was not paused.
+func (db *DB) Resume(scope, reason, actor string) (bool, error) {
+	result, err := db.Exec(`DELETE FROM scheduler_pauses WHERE scope = $1`, scope)
+	if err != nil {
+		return false, fmt.Errorf("failed to resume %s: %w", scope, err)
 	}
 
-	if offset > 0 {
-		argCount++
-		query += fmt.Sprintf(" OFFSET $%d", argCount)
-		args = append(args, offset)
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return false, nil
 	}
 
-	rows, err := db.Query(query, args...)
+	db.recordPauseEvent(scope, "resume", actor, reason)
+	log.WithFields(log.Fields{
+		"scope": scope,
+		"actor": actor,
+	}).Warn("Resumed job execution")
+
+	// Jobs that came due while paused can run now.
+	db.notify(uuid.Nil, fmt.Sprintf(`{"table":"scheduler_pauses","scope":%q}`, scope))
+	return true, nil
+}
+
+// ListPauses returns the active pauses.
+func (db *DB) ListPauses() ([]Pause, error) {
+	rows, err := db.Query(`SELECT scope, reason, paused_by, paused_at FROM scheduler_pauses ORDER BY scope`)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list jobs: %w", err)
+		return nil, fmt.Errorf("failed to query pauses: %w", err)
 	}
 	defer rows.Close()
 
-	var jobs []ScheduledJob
+	pauses := []Pause{}
 	for rows.Next() {
-		j, err := scanJob(rows.Scan)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan job: %w", err)
+		var p Pause
+		if err := rows.Scan(&p.Scope, &p.Reason, &p.PausedBy, &p.PausedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan pause: %w", err)
 		}
-		jobs = append(jobs, j)
+		pauses = append(pauses, p)
 	}
 
-	return jobs, nil
+	return pauses, nil
 }
 
-// UpdateJobStatus updates the status of a generic job.
-func (db *DB) UpdateJobStatus(id uuid.UUID, status string, errorMsg *string) error {
+// GetPause returns the pause that blocks jobType, global first, or nil.
+func (db *DB) GetPause(jobType string) (*Pause, error) {
+	var p Pause
+	err := db.QueryRow(`
+		SELECT scope, reason, paused_by, paused_at FROM scheduler_pauses
+		WHERE scope IN ('*', $1)
+		ORDER BY scope = '*' DESC
+		LIMIT 1
+	`, jobType).Scan(&p.Scope, &p.Reason, &p.PausedBy, &p.PausedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pause: %w", err)
+	}
+	return &p, nil
+}
+
+func (db *DB) recordPauseEvent(scope, action, actor, reason string) {
+	_, err := db.Exec(`
+		INSERT INTO scheduler_pause_events (scope, action, actor, reason)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+	`, scope, action, actor, reason)
+	if err != nil {
+		log.WithField("scope", scope).Errorf("Failed to record pause event: %v", err)
+	}
+}
+
+// ClaimJob claims a single pending job for immediate execution, regardless of
+// its schedule_time. It returns nil if the job does not exist or is no longer
+// pending.
+func (db *DB) ClaimJob(id uuid.UUID, workerID string, lease time.Duration) (*ScheduledJob, error) {
+	query := fmt.Sprintf(`
+		UPDATE scheduled_provisions
+		SET status = $1, claimed_by = $2,
+		    lease_expires_at = NOW() + $3 * INTERVAL '1 second',
+		    updated_at = NOW()
+		WHERE id = $4 AND status = $5
+		RETURNING %s
+	`, jobColumns)
+
+	j, err := scanJob(db.QueryRow(query, StatusExecuting, workerID, lease.Seconds(), id, StatusPending).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+
+	return &j, nil
+}
+
+// FinishJob moves a job claimed by workerID out of executing and releases the
+// claim. It returns ErrJobNotClaimed if the worker no longer owns the job, and
+// ErrCancelRequested if someone asked for the job to be cancelled meanwhile.
+func (db *DB) FinishJob(id uuid.UUID, workerID string, status string, errorMsg *string) error {
 	now := time.Now()
 	query := `
 		UPDATE scheduled_provisions
-		SET status = $1, updated_at = $2, executed_at = $3, error_message = $4
-		WHERE id = $5
+		SET status = $1, updated_at = $2, executed_at = $3, error_message = $4,
+		    claimed_by = NULL, lease_expires_at = NULL
+		WHERE id = $5 AND claimed_by = $6 AND status = $7 AND cancel_requested_at IS NULL
 	`
 
 	var executedAt *time.Time
-	if status == StatusCompleted || status == StatusFailed {
+	if status == StatusCompleted || status == StatusCompletedDryRun || status == StatusFailed {
 		executedAt = &now
 	}
 
-	_, err := db.Exec(query, status, now, executedAt, errorMsg, id)
+	result, err := db.Exec(query, status, now, executedAt, errorMsg, id, workerID, StatusExecuting)
 	if err != nil {
-		return fmt.Errorf("failed to update job status: %w", err)
+		return fmt.Errorf("failed to finish job: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return db.unreleasedJobError(id, workerID)
 	}
 
 	log.WithFields(log.Fields{
@@ -660,70 +904,1717 @@ func (db *DB) UpdateJobStatus(id uuid.UUID, status string, errorMsg *string) err
 		"status": status,
 	}).Info("Updated job status")
 
+	// A completed job may release jobs that depend on it.
+	if status == StatusPending || status == StatusCompleted || status == StatusCompletedDryRun {
+		db.notifyWakeup("scheduled_provisions", id)
+	}
+
 	return nil
 }
 
-// CancelJob cancels a scheduled job (only if currently pending).
-func (db *DB) CancelJob(id uuid.UUID) error {
-	query := `
+// FailJob marks a job claimed by workerID as permanently failed, recording
+// why, and releases the claim. If attempted is set the failed execution is
+// counted in retry_count. Like FinishJob it returns ErrJobNotClaimed or
+// ErrCancelRequested instead.
+func (db *DB) FailJob(id uuid.UUID, workerID string, failureReason string, errorMsg string, attempted bool) error {
+	result, err := db.Exec(`
 		UPDATE scheduled_provisions
-		SET status = $1, updated_at = NOW()
-		WHERE id = $2 AND status = $3
-	`
-
-	result, err := db.Exec(query, StatusCancelled, id, StatusPending)
+		SET status = $1, failure_reason = $2, error_message = $3,
+		    retry_count = retry_count + CASE WHEN $4 THEN 1 ELSE 0 END,
+		    executed_at = NOW(), updated_at = NOW(),
+		    claimed_by = NULL, lease_expires_at = NULL
+		WHERE id = $5 AND claimed_by = $6 AND status = $7 AND cancel_requested_at IS NULL
+	`, StatusFailed, failureReason, errorMsg, attempted, id, workerID, StatusExecuting)
 	if err != nil {
-		return fmt.Errorf("failed to cancel job: %w", err)
+		return fmt.Errorf("failed to fail job: %w", err)
 	}
 
 	affected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
-
 	if affected == 0 {
-		return fmt.Errorf("job not found or not in pending status")
+		return db.unreleasedJobError(id, workerID)
 	}
 
-	log.WithField("id", id).Info("Cancelled job")
+	log.WithFields(log.Fields{
+		"id":     id,
+		"reason": failureReason,
+	}).Info("Job failed permanently")
 	return nil
 }
 
-// IncrementJobRetryCount increments the retry_count for a job.
-func (db *DB) IncrementJobRetryCount(id uuid.UUID) error {
+// RetryJob returns a job claimed by workerID to pending, bumps its retry count
+// and holds it back until nextAttempt. It returns ErrJobNotClaimed if the
+// worker no longer owns the job, and ErrCancelRequested if someone asked for
+// the job to be cancelled meanwhile.
+func (db *DB) RetryJob(id uuid.UUID, workerID string, errorMsg string, nextAttempt time.Time) error {
 	query := `
 		UPDATE scheduled_provisions
-		SET retry_count = retry_count + 1, updated_at = NOW()
-		WHERE id = $1
+		SET status = $1, updated_at = NOW(), error_message = $2,
+		    retry_count = retry_count + 1, next_attempt_at = $3,
+		    claimed_by = NULL, lease_expires_at = NULL
+		WHERE id = $4 AND claimed_by = $5 AND status = $6 AND cancel_requested_at IS NULL
 	`
 
-	_, err := db.Exec(query, id)
+	result, err := db.Exec(query, StatusPending, errorMsg, nextAttempt, id, workerID, StatusExecuting)
+	if err != nil {
+		return fmt.Errorf("failed to schedule job retry: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to increment job retry count: %w", err)
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return db.unreleasedJobError(id, workerID)
 	}
 
+	log.WithFields(log.Fields{
+		"id":              id,
+		"next_attempt_at": nextAttempt,
+	}).Info("Scheduled job retry")
+
+	db.notifyWakeup("scheduled_provisions", id)
+
 	return nil
 }
 
-// ---- ManagedUser methods ----
-
-// ListManagedUsers returns a paginated, optionally filtered list of users.
-func (db *DB) ListManagedUsers(search *string, department *string, status *string, limit, offset int) ([]ManagedUser, error) {
-	query := `
-		SELECT id, email, full_name, given_name, family_name, department, job_title,
-		       manager_email, org_unit_path, is_admin, is_delegated_admin,
-		       is_suspended, google_id, status, metadata, last_synced_at,
-		       created_at, updated_at
-		FROM managed_users
-		WHERE 1=1
-	`
-	args := []interface{}{}
-	n := 0
+// DeferJob returns a job claimed by workerID to pending without counting an
+// attempt, holding it back until the given time and recording why. Like
+// RetryJob it returns ErrJobNotClaimed or ErrCancelRequested instead.
+func (db *DB) DeferJob(id uuid.UUID, workerID string, until time.Time, reason string) error {
+	result, err := db.Exec(`
+		UPDATE scheduled_provisions
+		SET status = $1, next_attempt_at = $2, deferred_reason = $3, updated_at = NOW(),
+		    claimed_by = NULL, lease_expires_at = NULL
+		WHERE id = $4 AND claimed_by = $5 AND status = $6 AND cancel_requested_at IS NULL
+	`, StatusPending, until, reason, id, workerID, StatusExecuting)
+	if err != nil {
+		return fmt.Errorf("failed to defer job: %w", err)
+	}
 
-	if search != nil && *search != "" {
-		n++
-		query += fmt.Sprintf(" AND (email ILIKE $%d OR full_name ILIKE $%d)", n, n)
-		args = append(args, "%"+*search+"%")
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return db.unreleasedJobError(id, workerID)
+	}
+
+	log.WithFields(log.Fields{
+		"id":     id,
+		"until":  until,
+		"reason": reason,
+	}).Info("Deferred job")
+
+	db.notifyWakeup("scheduled_provisions", id)
+
+	return nil
+}
+
+// AwaitJobCallback parks a job claimed by workerID until its target reports
+// the outcome with the given callback token, or until deadline passes. The
+// claim is released, since no worker is busy with the job meanwhile. Like
+// RetryJob it returns ErrJobNotClaimed or ErrCancelRequested instead.
+func (db *DB) AwaitJobCallback(id uuid.UUID, workerID string, token string, deadline time.Time) error {
+	result, err := db.Exec(`
+		UPDATE scheduled_provisions
+		SET status = $1, callback_token = $2, callback_deadline = $3, updated_at = NOW(),
+		    claimed_by = NULL, lease_expires_at = NULL
+		WHERE id = $4 AND claimed_by = $5 AND status = $6 AND cancel_requested_at IS NULL
+	`, StatusAwaitingCallback, token, deadline, id, workerID, StatusExecuting)
+	if err != nil {
+		return fmt.Errorf("failed to await job callback: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return db.unreleasedJobError(id, workerID)
+	}
+
+	log.WithFields(log.Fields{
+		"id":       id,
+		"deadline": deadline,
+	}).Info("Job awaiting callback")
+
+	return nil
+}
+
+// unreleasedJobError explains why a worker could not release a job it was
+// executing: ErrCancelRequested if it still holds the claim but someone asked
+// for the job to be cancelled, and ErrJobNotClaimed otherwise.
+func (db *DB) unreleasedJobError(id uuid.UUID, workerID string) error {
+	var cancelRequested bool
+	err := db.QueryRow(`
+		SELECT cancel_requested_at IS NOT NULL FROM scheduled_provisions
+		WHERE id = $1 AND claimed_by = $2 AND status = $3
+	`, id, workerID, StatusExecuting).Scan(&cancelRequested)
+	if err == sql.ErrNoRows {
+		return ErrJobNotClaimed
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check job claim: %w", err)
+	}
+	if cancelRequested {
+		return ErrCancelRequested
+	}
+	return ErrJobNotClaimed
+}
+
+// GetJobByCallbackToken returns the job waiting on the given callback token,
+// or nil if no job is.
+func (db *DB) GetJobByCallbackToken(token string) (*ScheduledJob, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM scheduled_provisions
+		WHERE callback_token = $1 AND status = $2
+	`, jobColumns)
+
+	j, err := scanJob(db.QueryRow(query, token, StatusAwaitingCallback).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job by callback token: %w", err)
+	}
+
+	return &j, nil
+}
+
+// GetExpiredCallbacks returns jobs whose callback deadline has passed.
+func (db *DB) GetExpiredCallbacks() ([]ScheduledJob, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM scheduled_provisions
+		WHERE status = $1 AND callback_deadline < NOW()
+		ORDER BY callback_deadline ASC
+	`, jobColumns)
+
+	rows, err := db.Query(query, StatusAwaitingCallback)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired callbacks: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []ScheduledJob
+	for rows.Next() {
+		j, err := scanJob(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+
+	return jobs, nil
+}
+
+// ResolveJobCallback records the outcome of a job that was awaiting a
+// callback: completed, failed, or pending again for a retry at nextAttempt.
+// The update only applies while the job still waits on the same token, so a
+// callback racing the deadline is applied at most once. Unless the job
+// completed, its latest attempt is marked failed with errorMsg. A failed
+// job records failureReason.
+func (db *DB) ResolveJobCallback(job ScheduledJob, status string, errorMsg *string, result JSONB, nextAttempt *time.Time, failureReason string) (bool, error) {
+	var executedAt *time.Time
+	if status == StatusCompleted || status == StatusFailed {
+		now := time.Now()
+		executedAt = &now
+	}
+	retried := 0
+	if status != StatusCompleted {
+		retried = 1
+	}
+
+	res, err := db.Exec(`
+		UPDATE scheduled_provisions
+		SET status = $1, error_message = $2, callback_result = $3, executed_at = $4,
+		    next_attempt_at = $5, retry_count = retry_count + $6, updated_at = NOW(),
+		    failure_reason = CASE WHEN $1 = 'failed' THEN $10 ELSE failure_reason END,
+		    callback_token = NULL, callback_deadline = NULL
+		WHERE id = $7 AND status = $8 AND callback_token = $9
+	`, status, errorMsg, result, executedAt, nextAttempt, retried, job.ID, StatusAwaitingCallback, job.CallbackToken,
+		failureReason)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve job callback: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	if status != StatusCompleted {
+		_, err = db.Exec(`
+			UPDATE job_attempts SET status = $1, error_message = $2
+			WHERE id = (
+				SELECT id FROM job_attempts WHERE job_id = $3
+				ORDER BY attempt_number DESC, started_at DESC LIMIT 1
+			)
+		`, AttemptFailed, errorMsg, job.ID)
+		if err != nil {
+			log.WithField("id", job.ID).Errorf("Failed to mark attempt failed after callback: %v", err)
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"id":     job.ID,
+		"status": status,
+	}).Info("Resolved job callback")
+
+	if status == StatusPending || status == StatusCompleted {
+		db.notifyWakeup("scheduled_provisions", job.ID)
+	}
+
+	return true, nil
+}
+
+// RenewJobLease extends the lease on a job this worker is executing. It
+// returns ErrJobNotClaimed if the job was reaped or finished elsewhere.
+func (db *DB) RenewJobLease(id uuid.UUID, workerID string, lease time.Duration) error {
+	var cancelRequested bool
+	err := db.QueryRow(`
+		UPDATE scheduled_provisions
+		SET lease_expires_at = NOW() + $1 * INTERVAL '1 second'
+		WHERE id = $2 AND claimed_by = $3 AND status = $4
+		RETURNING cancel_requested_at IS NOT NULL
+	`, lease.Seconds(), id, workerID, StatusExecuting).Scan(&cancelRequested)
+	if err == sql.ErrNoRows {
+		return ErrJobNotClaimed
+	}
+	if err != nil {
+		return fmt.Errorf("failed to renew job lease: %w", err)
+	}
+	if cancelRequested {
+		return ErrCancelRequested
+	}
+
+	return nil
+}
+
+// GetExpiredLeases returns executing jobs whose lease has run out. Rows
+// left executing without a lease (from before leases existed) count as
+// expired once they have not been touched for staleAfter.
+func (db *DB) GetExpiredLeases(staleAfter time.Duration) ([]ScheduledJob, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM scheduled_provisions
+		WHERE status = $1
+		  AND (lease_expires_at < NOW()
+		       OR (lease_expires_at IS NULL AND updated_at < NOW() - $2 * INTERVAL '1 second'))
+		ORDER BY lease_expires_at ASC NULLS FIRST
+	`, jobColumns)
+
+	rows, err := db.Query(query, StatusExecuting, staleAfter.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired leases: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []ScheduledJob
+	for rows.Next() {
+		j, err := scanJob(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+
+	return jobs, nil
+}
+
+// ReapJob takes back a job whose lease expired, moving it to status (pending
+// for another attempt, failed, or cancelled if that was requested) and
+// recording reason as its error. The
+// update only applies if the job is still executing under the same claim,
+// so a worker that renewed its lease in the meantime keeps the job.
+func (db *DB) ReapJob(job ScheduledJob, status string, reason string, nextAttempt *time.Time) (bool, error) {
+	var executedAt *time.Time
+	if status == StatusFailed {
+		now := time.Now()
+		executedAt = &now
+	}
+
+	result, err := db.Exec(`
+		UPDATE scheduled_provisions
+		SET status = $1, error_message = $2, next_attempt_at = $3, executed_at = $4,
+		    retry_count = retry_count + 1, updated_at = NOW(),
+		    cancelled_at = CASE WHEN $1 = 'cancelled' THEN NOW() ELSE cancelled_at END,
+		    failure_reason = CASE WHEN $1 = 'failed' THEN $9 ELSE failure_reason END,
+		    claimed_by = NULL, lease_expires_at = NULL
+		WHERE id = $5 AND status = $6
+		  AND claimed_by IS NOT DISTINCT FROM $7
+		  AND lease_expires_at IS NOT DISTINCT FROM $8
+	`, status, reason, nextAttempt, executedAt, job.ID, StatusExecuting, job.ClaimedBy, job.LeaseExpiresAt,
+		FailureLeaseExpired)
+	if err != nil {
+		return false, fmt.Errorf("failed to reap job: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected > 0 && status == StatusPending {
+		db.notifyWakeup("scheduled_provisions", job.ID)
+	}
+
+	return affected > 0, nil
+}
+
+// GetJobByID retrieves a generic job by its UUID.
+func (db *DB) GetJobByID(id uuid.UUID) (*ScheduledJob, error) {
+	query := fmt.Sprintf(`SELECT %s FROM scheduled_provisions WHERE id = $1`, jobColumns)
+
+	j, err := scanJob(db.QueryRow(query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	return &j, nil
+}
+
+// GetJobByIdempotencyKey retrieves the job created with the given key, or
+// nil if there is none.
+func (db *DB) GetJobByIdempotencyKey(key string) (*ScheduledJob, error) {
+	query := fmt.Sprintf(`SELECT %s FROM scheduled_provisions WHERE idempotency_key = $1`, jobColumns)
+
+	j, err := scanJob(db.QueryRow(query, key).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job by idempotency key: %w", err)
+	}
+
+	return &j, nil
+}
+
+// ListJobs lists jobs with optional filters.
+func (db *DB) ListJobs(status *string, tag *string, jobType *string, limit int, offset int) ([]ScheduledJob, error) {
+	query := fmt.Sprintf(`SELECT %s FROM scheduled_provisions WHERE 1=1`, jobColumns)
+
+	args := []interface{}{}
+	argCount := 0
+
+	if status != nil {
+		argCount++
+		query += fmt.Sprintf(" AND status = $%d", argCount)
+		args = append(args, *status)
+	}
+
+	if tag != nil {
+		argCount++
+		query += fmt.Sprintf(" AND $%d = ANY(tags)", argCount)
+		args = append(args, *tag)
+	}
+
+	if jobType != nil {
+		argCount++
+		query += fmt.Sprintf(" AND job_type = $%d", argCount)
+		args = append(args, *jobType)
+	}
+
+	query += " ORDER BY schedule_time DESC"
+
+	if limit > 0 {
+		argCount++
+		query += fmt.Sprintf(" LIMIT $%d", argCount)
+		args = append(args, limit)
+	}
+
+	if offset > 0 {
+		argCount++
+		query += fmt.Sprintf(" OFFSET $%d", argCount)
+		args = append(args, offset)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []ScheduledJob
+	for rows.Next() {
+		j, err := scanJob(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+
+	return jobs, nil
+}
+
+// UpdateJobStatus updates the status of a generic job.
+func (db *DB) UpdateJobStatus(id uuid.UUID, status string, errorMsg *string) error {
+	now := time.Now()
+	query := `
+		UPDATE scheduled_provisions
+		SET status = $1, updated_at = $2, executed_at = $3, error_message = $4
+		WHERE id = $5
+	`
+
+	var executedAt *time.Time
+	if status == StatusCompleted || status == StatusCompletedDryRun || status == StatusFailed {
+		executedAt = &now
+	}
+
+	_, err := db.Exec(query, status, now, executedAt, errorMsg, id)
+	if err != nil {
+		return fmt.Errorf("failed to update job status: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"id":     id,
+		"status": status,
+	}).Info("Updated job status")
+
+	if status == StatusPending {
+		db.notifyWakeup("scheduled_provisions", id)
+	}
+
+	return nil
+}
+
+// CancelJob cancels a job on behalf of cancelledBy and returns the status it
+// was in. Pending jobs and jobs awaiting a callback are cancelled at once.
+// An executing job only gets cancel_requested_at set; its worker aborts the
+// execution and calls FinishCancelledJob. It returns ErrJobNotCancellable if
+// the job does not exist or has already finished.
+func (db *DB) CancelJob(id uuid.UUID, cancelledBy string) (string, error) {
+	var previous string
+	err := db.QueryRow(`
+		WITH prev AS (
+			SELECT id, status FROM scheduled_provisions WHERE id = $1 FOR UPDATE
+		)
+		UPDATE scheduled_provisions sp
+		SET status = CASE WHEN prev.status = $2 THEN prev.status ELSE $3 END,
+		    cancelled_at = CASE WHEN prev.status = $2 THEN NULL ELSE NOW() END,
+		    cancel_requested_at = NOW(), cancelled_by = $4,
+		    callback_token = NULL, callback_deadline = NULL,
+		    updated_at = NOW()
+		FROM prev
+		WHERE sp.id = prev.id AND prev.status IN ($5, $2, $6)
+		RETURNING prev.status
+	`, id, StatusExecuting, StatusCancelled, cancelledBy, StatusPending, StatusAwaitingCallback).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return "", ErrJobNotCancellable
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	if previous == StatusExecuting {
+		log.WithField("id", id).Info("Requested cancellation of executing job")
+		db.notifyCancel(id)
+	} else {
+		log.WithField("id", id).Info("Cancelled job")
+	}
+	return previous, nil
+}
+
+// RecordJobError sets the error message on a job without changing its status.
+func (db *DB) RecordJobError(id uuid.UUID, errorMsg string) error {
+	_, err := db.Exec(`
+		UPDATE scheduled_provisions SET error_message = $1, updated_at = NOW() WHERE id = $2
+	`, errorMsg, id)
+	if err != nil {
+		return fmt.Errorf("failed to record job error: %w", err)
+	}
+	return nil
+}
+
+// FinishCancelledJob marks a job whose execution this worker aborted after a
+// cancellation request as cancelled, and releases the claim.
+func (db *DB) FinishCancelledJob(id uuid.UUID, workerID string, errorMsg *string) error {
+	result, err := db.Exec(`
+		UPDATE scheduled_provisions
+		SET status = $1, cancelled_at = NOW(), error_message = $2, updated_at = NOW(),
+		    claimed_by = NULL, lease_expires_at = NULL
+		WHERE id = $3 AND claimed_by = $4 AND status = $5
+	`, StatusCancelled, errorMsg, id, workerID, StatusExecuting)
+	if err != nil {
+		return fmt.Errorf("failed to finish cancelled job: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrJobNotClaimed
+	}
+
+	log.WithField("id", id).Info("Cancelled executing job")
+	return nil
+}
+
+// UpdatePendingJob applies update to a pending job, provided it has not been
+// modified since expectedUpdatedAt, and records the edit in job_edits. If
+// the payload changes on a job that went through approval, approval is
+// requested again. It returns nil if the job does not exist, ErrJobNotEditable
+// if it is no longer pending, and ErrStaleJob (with the current job) if
+// updated_at does not match.
+func (db *DB) UpdatePendingJob(id uuid.UUID, expectedUpdatedAt time.Time, update JobUpdate) (*ScheduledJob, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	query := fmt.Sprintf(`SELECT %s FROM scheduled_provisions WHERE id = $1 FOR UPDATE`, jobColumns)
+	job, err := scanJob(tx.QueryRow(query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	if job.Status != StatusPending {
+		return &job, ErrJobNotEditable
+	}
+	// Postgres keeps microseconds; clients may echo back either precision.
+	if !job.UpdatedAt.Truncate(time.Microsecond).Equal(expectedUpdatedAt.Truncate(time.Microsecond)) {
+		return &job, ErrStaleJob
+	}
+
+	changes := map[string]map[string]interface{}{}
+	change := func(field string, from, to interface{}) {
+		changes[field] = map[string]interface{}{"from": from, "to": to}
+	}
+
+	if update.ScheduleTime != nil && !update.ScheduleTime.Equal(job.ScheduleTime) {
+		change("schedule_time", job.ScheduleTime, *update.ScheduleTime)
+		job.ScheduleTime = *update.ScheduleTime
+		// A new start time supersedes any backoff or calendar deferral.
+		job.NextAttemptAt = nil
+		job.DeferredReason = nil
+	}
+	if update.Tags != nil && !equalStrings(job.Tags, *update.Tags) {
+		change("tags", job.Tags, *update.Tags)
+		job.Tags = *update.Tags
+	}
+	if update.TargetUserEmail != nil && (job.TargetUserEmail == nil || *job.TargetUserEmail != *update.TargetUserEmail) {
+		change("target_user_email", job.TargetUserEmail, *update.TargetUserEmail)
+		job.TargetUserEmail = update.TargetUserEmail
+	}
+	if update.Priority != nil && *update.Priority != job.Priority {
+		change("priority", job.Priority, *update.Priority)
+		job.Priority = *update.Priority
+	}
+	if update.Payload != nil && !equalJSON(job.Payload, update.Payload) {
+		change("payload", json.RawMessage(job.Payload), json.RawMessage(update.Payload))
+		job.Payload = update.Payload
+
+		if job.ApprovalStatus != ApprovalAutoApproved && job.ApprovalStatus != ApprovalPending {
+			change("approval_status", job.ApprovalStatus, ApprovalPending)
+			job.ApprovalStatus = ApprovalPending
+			job.ApprovedBy = nil
+		}
+	}
+
+	if len(changes) == 0 {
+		return &job, nil
+	}
+
+	err = tx.QueryRow(`
+		UPDATE scheduled_provisions
+		SET schedule_time = $1, tags = $2, target_user_email = $3, payload = $4,
+		    approval_status = $5, approved_by = $6, next_attempt_at = $7, deferred_reason = $8,
+		    priority = $9, updated_at = NOW()
+		WHERE id = $10
+		RETURNING updated_at
+	`, job.ScheduleTime, job.Tags, job.TargetUserEmail, job.Payload,
+		job.ApprovalStatus, job.ApprovedBy, job.NextAttemptAt, job.DeferredReason, job.Priority, id).Scan(&job.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update job: %w", err)
+	}
+
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job changes: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO job_edits (id, job_id, edited_by, edited_at, changes)
+		VALUES ($1, $2, $3, $4, $5)
+	`, uuid.New(), id, update.EditedBy, job.UpdatedAt, changesJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record job edit: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit job edit: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"id":     id,
+		"fields": len(changes),
+	}).Info("Edited pending job")
+
+	db.notifyWakeup("scheduled_provisions", id)
+	return &job, nil
+}
+
+// ListJobEdits returns the edit history of a job, oldest first.
+func (db *DB) ListJobEdits(jobID uuid.UUID) ([]JobEdit, error) {
+	rows, err := db.Query(`
+		SELECT id, job_id, edited_by, edited_at, changes
+		FROM job_edits
+		WHERE job_id = $1
+		ORDER BY edited_at ASC
+	`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job edits: %w", err)
+	}
+	defer rows.Close()
+
+	edits := []JobEdit{}
+	for rows.Next() {
+		var e JobEdit
+		if err := rows.Scan(&e.ID, &e.JobID, &e.EditedBy, &e.EditedAt, &e.Changes); err != nil {
+			return nil, fmt.Errorf("failed to scan job edit: %w", err)
+		}
+		edits = append(edits, e)
+	}
+
+	return edits, nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalJSON reports whether two JSON documents have the same value,
+// ignoring formatting and key order.
+func equalJSON(a, b []byte) bool {
+	var av, bv interface{}
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return bytes.Equal(a, b)
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+// CreatePlan inserts a plan and its steps in one transaction. Steps may set
+// their own IDs and list sibling steps in DependsOn.
+func (db *DB) CreatePlan(plan *JobPlan) error {
+	plan.ID = uuid.New()
+	plan.CreatedAt = time.Now()
+	plan.Status = PlanStatusActive
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	_, err = tx.Exec(`
+		INSERT INTO job_plans (id, name, target_user_email, start_time, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, plan.ID, plan.Name, plan.TargetUserEmail, plan.StartTime, plan.CreatedBy, plan.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create plan: %w", err)
+	}
+
+	// Insert steps in an order where every dependency already exists.
+	inserted := map[uuid.UUID]bool{}
+	for len(inserted) < len(plan.Steps) {
+		progressed := false
+		for i := range plan.Steps {
+			step := &plan.Steps[i]
+			if inserted[step.ID] || !allInserted(step.DependsOn, inserted) {
+				continue
+			}
+			step.PlanID = &plan.ID
+			if err := insertJob(tx, step); err != nil {
+				return err
+			}
+			inserted[step.ID] = true
+			progressed = true
+		}
+		if !progressed {
+			return fmt.Errorf("failed to create plan: steps have circular or unknown dependencies")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit plan: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"id":    plan.ID,
+		"name":  plan.Name,
+		"steps": len(plan.Steps),
+	}).Info("Created job plan")
+
+	db.notifyWakeup("scheduled_provisions", plan.ID)
+	return nil
+}
+
+func allInserted(ids []uuid.UUID, inserted map[uuid.UUID]bool) bool {
+	for _, id := range ids {
+		if !inserted[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetPlan returns a plan with its steps ordered by schedule_time, or nil if
+// it does not exist.
+func (db *DB) GetPlan(id uuid.UUID) (*JobPlan, error) {
+	var plan JobPlan
+	err := db.QueryRow(`
+		SELECT id, name, target_user_email, start_time, created_by, created_at, cancelled_at, cancelled_by
+		FROM job_plans WHERE id = $1
+	`, id).Scan(&plan.ID, &plan.Name, &plan.TargetUserEmail, &plan.StartTime,
+		&plan.CreatedBy, &plan.CreatedAt, &plan.CancelledAt, &plan.CancelledBy)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s FROM scheduled_provisions
+		WHERE plan_id = $1
+		ORDER BY schedule_time ASC, created_at ASC
+	`, jobColumns)
+	rows, err := db.Query(query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plan steps: %w", err)
+	}
+	defer rows.Close()
+
+	plan.Steps = []ScheduledJob{}
+	for rows.Next() {
+		j, err := scanJob(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		plan.Steps = append(plan.Steps, j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list plan steps: %w", err)
+	}
+
+	plan.Status = planStatus(plan)
+	return &plan, nil
+}
+
+// planStatus derives a plan's status from its steps.
+func planStatus(plan JobPlan) string {
+	if plan.CancelledAt != nil {
+		return PlanStatusCancelled
+	}
+	done := true
+	for _, step := range plan.Steps {
+		switch step.Status {
+		case StatusFailed:
+			return PlanStatusHeld
+		case StatusCompleted, StatusCompletedDryRun, StatusCancelled:
+		default:
+			done = false
+		}
+	}
+	if done {
+		return PlanStatusCompleted
+	}
+	return PlanStatusActive
+}
+
+// MarkPlanCancelled records that a plan was cancelled. Its steps are
+// cancelled separately. It returns false if the plan does not exist; a plan
+// that was already cancelled keeps its original cancellation.
+func (db *DB) MarkPlanCancelled(id uuid.UUID, cancelledBy string) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE job_plans
+		SET cancelled_at = COALESCE(cancelled_at, NOW()),
+		    cancelled_by = COALESCE(cancelled_by, $1)
+		WHERE id = $2
+	`, cancelledBy, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel plan: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// RetryPlan returns the failed steps of a plan to pending with a fresh retry
+// count, which releases the hold on the rest of the plan. It returns the
+// number of steps retried, or ErrPlanCancelled if the plan was cancelled.
+func (db *DB) RetryPlan(id uuid.UUID) (int, error) {
+	result, err := db.Exec(`
+		UPDATE scheduled_provisions
+		SET status = $1, retry_count = 0, next_attempt_at = NULL, executed_at = NULL,
+		    deferred_reason = NULL, failure_reason = NULL, updated_at = NOW()
+		WHERE plan_id = $2 AND status = $3
+		  AND NOT EXISTS (SELECT 1 FROM scheduled_provisions r WHERE r.replayed_from = scheduled_provisions.id)
+		  AND NOT EXISTS (SELECT 1 FROM job_plans p WHERE p.id = $2 AND p.cancelled_at IS NOT NULL)
+	`, StatusPending, id, StatusFailed)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retry plan: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		var cancelled bool
+		err := db.QueryRow(`SELECT cancelled_at IS NOT NULL FROM job_plans WHERE id = $1`, id).Scan(&cancelled)
+		if err == nil && cancelled {
+			return 0, ErrPlanCancelled
+		}
+		return 0, nil
+	}
+
+	log.WithFields(log.Fields{
+		"id":    id,
+		"steps": affected,
+	}).Info("Retrying failed plan steps")
+
+	db.notifyWakeup("scheduled_provisions", id)
+	return int(affected), nil
+}
+
+// CreateBatch inserts a batch and its jobs in one transaction, so either
+// every job is created or none is. An error caused by a single job names
+// its 1-based row.
+func (db *DB) CreateBatch(batch *JobBatch) error {
+	batch.ID = uuid.New()
+	batch.CreatedAt = time.Now()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	_, err = tx.Exec(`
+		INSERT INTO job_batches (id, name, created_by, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, batch.ID, batch.Name, batch.CreatedBy, batch.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create batch: %w", err)
+	}
+
+	for i := range batch.Jobs {
+		job := &batch.Jobs[i]
+		job.BatchID = &batch.ID
+		if err := insertJob(tx, job); err != nil {
+			return fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit batch: %w", err)
+	}
+
+	batch.Total = len(batch.Jobs)
+	batch.Progress = batchProgress(batch.Jobs)
+	batch.Status = batchStatus(*batch)
+
+	log.WithFields(log.Fields{
+		"id":   batch.ID,
+		"name": batch.Name,
+		"jobs": len(batch.Jobs),
+	}).Info("Created job batch")
+
+	db.notifyWakeup("scheduled_provisions", batch.ID)
+	return nil
+}
+
+// GetBatch returns a batch with its jobs in the order they were submitted,
+// or nil if it does not exist. Replays of failed jobs belong to the batch
+// too; the jobs they replaced are listed but not counted in its progress.
+func (db *DB) GetBatch(id uuid.UUID) (*JobBatch, error) {
+	var batch JobBatch
+	err := db.QueryRow(`
+		SELECT id, name, created_by, created_at, cancelled_at, cancelled_by
+		FROM job_batches WHERE id = $1
+	`, id).Scan(&batch.ID, &batch.Name, &batch.CreatedBy, &batch.CreatedAt,
+		&batch.CancelledAt, &batch.CancelledBy)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s FROM scheduled_provisions
+		WHERE batch_id = $1
+		ORDER BY created_at ASC
+	`, jobColumns)
+	rows, err := db.Query(query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list batch jobs: %w", err)
+	}
+	defer rows.Close()
+
+	batch.Jobs = []ScheduledJob{}
+	for rows.Next() {
+		j, err := scanJob(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		batch.Jobs = append(batch.Jobs, j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list batch jobs: %w", err)
+	}
+
+	batch.Progress = batchProgress(batch.Jobs)
+	for _, n := range batch.Progress {
+		batch.Total += n
+	}
+	batch.Status = batchStatus(batch)
+	return &batch, nil
+}
+
+// batchProgress counts the jobs of a batch by status, leaving out failed
+// jobs that were replayed.
+func batchProgress(jobs []ScheduledJob) map[string]int {
+	progress := map[string]int{}
+	for _, job := range jobs {
+		if job.ReplayedAs != nil {
+			continue
+		}
+		progress[job.Status]++
+	}
+	return progress
+}
+
+// batchStatus derives a batch's status from the progress of its jobs.
+func batchStatus(batch JobBatch) string {
+	if batch.CancelledAt != nil {
+		return BatchStatusCancelled
+	}
+	done := 0
+	for _, status := range []string{StatusCompleted, StatusCompletedDryRun, StatusCancelled, StatusFailed} {
+		done += batch.Progress[status]
+	}
+	switch {
+	case done < batch.Total:
+		return BatchStatusActive
+	case batch.Progress[StatusFailed] > 0:
+		return BatchStatusCompletedWithErrors
+	default:
+		return BatchStatusCompleted
+	}
+}
+
+// MarkBatchCancelled records that a batch was cancelled. Its jobs are
+// cancelled separately. It returns false if the batch does not exist; a
+// batch that was already cancelled keeps its original cancellation.
+func (db *DB) MarkBatchCancelled(id uuid.UUID, cancelledBy string) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE job_batches
+		SET cancelled_at = COALESCE(cancelled_at, NOW()),
+		    cancelled_by = COALESCE(cancelled_by, $1)
+		WHERE id = $2
+	`, cancelledBy, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel batch: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// templateColumns lists the job_templates columns in the order scanTemplate
+// expects them.
+const templateColumns = `name, version, job_type, description, payload, parameters, created_by, created_at`
+
+func scanTemplate(scan func(dest ...interface{}) error) (JobTemplate, error) {
+	var t JobTemplate
+	err := scan(&t.Name, &t.Version, &t.JobType, &t.Description, &t.Payload, &t.Parameters,
+		&t.CreatedBy, &t.CreatedAt)
+	return t, err
+}
+
+// CreateTemplate saves t as the next version of the template with its name,
+// starting at 1, and sets t.Version accordingly.
+func (db *DB) CreateTemplate(t *JobTemplate) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	// Serialize concurrent saves of the same name so versions do not clash.
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('job_templates:' || $1))`, t.Name); err != nil {
+		return fmt.Errorf("failed to lock template: %w", err)
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO job_templates (name, version, job_type, description, payload, parameters, created_by, created_at)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5, $6, NOW()
+		FROM job_templates WHERE name = $1
+		RETURNING version, created_at
+	`, t.Name, t.JobType, t.Description, t.Payload, t.Parameters, t.CreatedBy).Scan(&t.Version, &t.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create template: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit template: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"name":     t.Name,
+		"version":  t.Version,
+		"job_type": t.JobType,
+	}).Info("Saved job template")
+	return nil
+}
+
+// GetTemplate returns a version of a template, or its latest version if
+// version is zero. It returns nil if it does not exist.
+func (db *DB) GetTemplate(name string, version int) (*JobTemplate, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM job_templates
+		WHERE name = $1 AND ($2 = 0 OR version = $2)
+		ORDER BY version DESC
+		LIMIT 1
+	`, templateColumns)
+
+	t, err := scanTemplate(db.QueryRow(query, name, version).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	return &t, nil
+}
+
+// ListTemplates returns the latest version of every template, by name.
+func (db *DB) ListTemplates() ([]JobTemplate, error) {
+	query := fmt.Sprintf(`
+		SELECT DISTINCT ON (name) %s FROM job_templates
+		ORDER BY name, version DESC
+	`, templateColumns)
+	return db.queryTemplates(query)
+}
+
+// ListTemplateVersions returns every version of a template, newest first.
+func (db *DB) ListTemplateVersions(name string) ([]JobTemplate, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM job_templates
+		WHERE name = $1
+		ORDER BY version DESC
+	`, templateColumns)
+	return db.queryTemplates(query, name)
+}
+
+func (db *DB) queryTemplates(query string, args ...interface{}) ([]JobTemplate, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []JobTemplate{}
+	for rows.Next() {
+		t, err := scanTemplate(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan template: %w", err)
+		}
+		templates = append(templates, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	return templates, nil
+}
+
+// JobBlockedReason explains why a pending job may not run yet because of its
+// dependencies or plan. It returns an empty string if nothing holds it back.
+func (db *DB) JobBlockedReason(id uuid.UUID) (string, error) {
+	var unmet int
+	var planHeld bool
+	err := db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM job_dependencies d
+			 JOIN scheduled_provisions dep ON dep.id = d.depends_on
+			 WHERE d.job_id = sp.id AND dep.status NOT IN ($2, $3)),
+			EXISTS (SELECT 1 FROM scheduled_provisions failed
+			        WHERE failed.plan_id = sp.plan_id AND failed.status = $4
+			          AND NOT EXISTS (SELECT 1 FROM scheduled_provisions r WHERE r.replayed_from = failed.id))
+		FROM scheduled_provisions sp
+		WHERE sp.id = $1
+	`, id, StatusCompleted, StatusCompletedDryRun, StatusFailed).Scan(&unmet, &planHeld)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to check job dependencies: %w", err)
+	}
+
+	switch {
+	case unmet > 0:
+		return fmt.Sprintf("waiting on %d unfinished dependencies", unmet), nil
+	case planHeld:
+		return "plan is held by a failed step", nil
+	}
+	return "", nil
+}
+
+// recurringJobColumns is the column list for RecurringJob queries.
+const recurringJobColumns = `id, name, job_type, payload, tags, target_user_email, requested_by,
+	schedule, timezone, start_time, end_time, paused, paused_by, paused_at,
+	materialized_until, created_at, updated_at`
+
+func scanRecurringJob(scan func(dest ...interface{}) error) (RecurringJob, error) {
+	var rj RecurringJob
+	err := scan(
+		&rj.ID, &rj.Name, &rj.JobType, &rj.Payload, &rj.Tags, &rj.TargetUserEmail, &rj.RequestedBy,
+		&rj.Schedule, &rj.Timezone, &rj.StartTime, &rj.EndTime, &rj.Paused, &rj.PausedBy, &rj.PausedAt,
+		&rj.MaterializedUntil, &rj.CreatedAt, &rj.UpdatedAt,
+	)
+	return rj, err
+}
+
+// CreateRecurringJob inserts a new recurring job definition.
+func (db *DB) CreateRecurringJob(rj *RecurringJob) error {
+	rj.ID = uuid.New()
+	rj.CreatedAt = time.Now()
+	rj.UpdatedAt = rj.CreatedAt
+	if rj.Tags == nil {
+		rj.Tags = pq.StringArray{}
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO recurring_jobs (
+			id, name, job_type, payload, tags, target_user_email, requested_by,
+			schedule, timezone, start_time, end_time, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`, rj.ID, rj.Name, rj.JobType, rj.Payload, rj.Tags, rj.TargetUserEmail, rj.RequestedBy,
+		rj.Schedule, rj.Timezone, rj.StartTime, rj.EndTime, rj.CreatedAt, rj.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create recurring job: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"id":       rj.ID,
+		"job_type": rj.JobType,
+		"schedule": rj.Schedule,
+	}).Info("Created recurring job")
+	return nil
+}
+
+// GetRecurringJob returns a recurring job definition, or nil if it does not
+// exist or was deleted.
+func (db *DB) GetRecurringJob(id uuid.UUID) (*RecurringJob, error) {
+	query := fmt.Sprintf(`SELECT %s FROM recurring_jobs WHERE id = $1 AND deleted_at IS NULL`, recurringJobColumns)
+	rj, err := scanRecurringJob(db.QueryRow(query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring job: %w", err)
+	}
+	return &rj, nil
+}
+
+// ListRecurringJobs returns all recurring job definitions that were not
+// deleted, oldest first.
+func (db *DB) ListRecurringJobs() ([]RecurringJob, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM recurring_jobs
+		WHERE deleted_at IS NULL
+		ORDER BY created_at ASC
+	`, recurringJobColumns)
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recurring jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []RecurringJob
+	for rows.Next() {
+		rj, err := scanRecurringJob(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan recurring job: %w", err)
+		}
+		jobs = append(jobs, rj)
+	}
+
+	return jobs, nil
+}
+
+// MaterializeOccurrences creates a pending job with the given priority for
+// each occurrence of rj and advances its materialized_until. Occurrences that
+// already have a job are skipped, so concurrent schedulers cannot create
+// duplicates. Nothing is created if rj was paused, deleted or edited since it
+// was read, as that cancelled the occurrences it would have. It returns the
+// number of jobs created.
+func (db *DB) MaterializeOccurrences(rj RecurringJob, occurrences []time.Time, priority int) (int, error) {
+	if len(occurrences) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var current bool
+	err = tx.QueryRow(`
+		SELECT TRUE FROM recurring_jobs
+		WHERE id = $1 AND NOT paused AND deleted_at IS NULL AND updated_at = $2
+		FOR UPDATE
+	`, rj.ID, rj.UpdatedAt).Scan(&current)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock recurring job: %w", err)
+	}
+
+	created := 0
+	for _, at := range occurrences {
+		result, err := tx.Exec(`
+			INSERT INTO scheduled_provisions (
+				id, job_type, payload, schedule_time, status, tags,
+				target_user_email, requested_by, approval_status,
+				created_at, updated_at, retry_count, recurring_job_id, priority
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW(), 0, $10, $11)
+			ON CONFLICT (recurring_job_id, schedule_time)
+				WHERE recurring_job_id IS NOT NULL AND status <> 'cancelled'
+				DO NOTHING
+		`, uuid.New(), rj.JobType, rj.Payload, at, StatusPending, rj.Tags,
+			rj.TargetUserEmail, rj.RequestedBy, ApprovalAutoApproved, rj.ID, priority)
+		if err != nil {
+			return 0, fmt.Errorf("failed to materialize recurring job: %w", err)
+		}
+		if affected, err := result.RowsAffected(); err == nil {
+			created += int(affected)
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE recurring_jobs
+		SET materialized_until = GREATEST(COALESCE(materialized_until, $1), $1), updated_at = NOW()
+		WHERE id = $2
+	`, occurrences[len(occurrences)-1], rj.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to advance recurring job: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit recurring jobs: %w", err)
+	}
+
+	if created > 0 {
+		log.WithFields(log.Fields{
+			"recurring_job_id": rj.ID,
+			"created":          created,
+		}).Info("Materialized recurring job occurrences")
+		db.notifyWakeup("scheduled_provisions", rj.ID)
+	}
+	return created, nil
+}
+
+// SetRecurringJobPaused pauses or resumes a recurring job. Pausing cancels
+// its pending occurrences; resuming materializes again from now on, so
+// occurrences missed while paused are skipped. It returns nil if the
+// definition does not exist.
+func (db *DB) SetRecurringJobPaused(id uuid.UUID, paused bool, actor string) (*RecurringJob, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	query := fmt.Sprintf(`
+		UPDATE recurring_jobs
+		SET paused = $1,
+		    paused_by = CASE WHEN $1 THEN $2::varchar ELSE NULL END,
+		    paused_at = CASE WHEN $1 THEN NOW() ELSE NULL END,
+		    materialized_until = CASE WHEN $1 THEN materialized_until ELSE NOW() END,
+		    updated_at = NOW()
+		WHERE id = $3 AND deleted_at IS NULL
+		RETURNING %s
+	`, recurringJobColumns)
+	rj, err := scanRecurringJob(tx.QueryRow(query, paused, actor, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update recurring job: %w", err)
+	}
+
+	if paused {
+		if err := cancelOccurrences(tx, id, actor); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit recurring job: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"id":     id,
+		"paused": paused,
+		"actor":  actor,
+	}).Info("Updated recurring job")
+	return &rj, nil
+}
+
+// DeleteRecurringJob deletes a recurring job definition and cancels its
+// pending occurrences. Jobs that already ran keep their link to it. It
+// returns false if the definition does not exist.
+func (db *DB) DeleteRecurringJob(id uuid.UUID, actor string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	result, err := tx.Exec(`
+		UPDATE recurring_jobs
+		SET deleted_at = NOW(), deleted_by = $1, updated_at = NOW()
+		WHERE id = $2 AND deleted_at IS NULL
+	`, actor, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete recurring job: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	if err := cancelOccurrences(tx, id, actor); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit recurring job: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"id":    id,
+		"actor": actor,
+	}).Info("Deleted recurring job")
+	return true, nil
+}
+
+// cancelOccurrences cancels the pending occurrences of a recurring job.
+func cancelOccurrences(tx *sql.Tx, recurringJobID uuid.UUID, actor string) error {
+	_, err := tx.Exec(`
+		UPDATE scheduled_provisions
+		SET status = $1, cancelled_at = NOW(), cancel_requested_at = NOW(), cancelled_by = $2,
+		    updated_at = NOW()
+		WHERE recurring_job_id = $3 AND status = $4
+	`, StatusCancelled, actor, recurringJobID, StatusPending)
+	if err != nil {
+		return fmt.Errorf("failed to cancel recurring job occurrences: %w", err)
+	}
+	return nil
+}
+
+// ListDeadLetters returns failed jobs that have not been replayed, most
+// recent failure first.
+func (db *DB) ListDeadLetters(filter DeadLetterFilter) ([]ScheduledJob, error) {
+	query := fmt.Sprintf(`SELECT %s FROM scheduled_provisions
+		WHERE id IN (SELECT id FROM dead_letter_jobs)`, jobColumns)
+	args := []interface{}{}
+	argCount := 0
+
+	if filter.JobType != nil {
+		argCount++
+		query += fmt.Sprintf(" AND job_type = $%d", argCount)
+		args = append(args, *filter.JobType)
+	}
+	if filter.FailureReason != nil {
+		argCount++
+		query += fmt.Sprintf(" AND failure_reason = $%d", argCount)
+		args = append(args, *filter.FailureReason)
+	}
+	if filter.Tag != nil {
+		argCount++
+		query += fmt.Sprintf(" AND $%d = ANY(tags)", argCount)
+		args = append(args, *filter.Tag)
+	}
+	if filter.BatchID != nil {
+		argCount++
+		query += fmt.Sprintf(" AND batch_id = $%d", argCount)
+		args = append(args, *filter.BatchID)
+	}
+	if filter.FailedAfter != nil {
+		argCount++
+		query += fmt.Sprintf(" AND executed_at >= $%d", argCount)
+		args = append(args, *filter.FailedAfter)
+	}
+	if filter.FailedBefore != nil {
+		argCount++
+		query += fmt.Sprintf(" AND executed_at < $%d", argCount)
+		args = append(args, *filter.FailedBefore)
+	}
+
+	query += " ORDER BY executed_at DESC NULLS LAST"
+
+	if filter.Limit > 0 {
+		argCount++
+		query += fmt.Sprintf(" LIMIT $%d", argCount)
+		args = append(args, filter.Limit)
+	}
+	if filter.Offset > 0 {
+		argCount++
+		query += fmt.Sprintf(" OFFSET $%d", argCount)
+		args = append(args, filter.Offset)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []ScheduledJob
+	for rows.Next() {
+		j, err := scanJob(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+
+	return jobs, nil
+}
+
+// ReplayJob clones a failed job into a new pending job linked to it through
+// replayed_from. Pending jobs that depended on the original depend on the
+// replay instead, and a plan held by the original continues once the replay
+// exists. An edited payload sends a job that needed approval back for
+// approval. It returns nil if the job does not exist, ErrJobNotReplayable if
+// it has not failed and ErrAlreadyReplayed if it was replayed before.
+func (db *DB) ReplayJob(id uuid.UUID, opts ReplayOptions) (*ScheduledJob, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	query := fmt.Sprintf(`SELECT %s FROM scheduled_provisions WHERE id = $1 FOR UPDATE`, jobColumns)
+	original, err := scanJob(tx.QueryRow(query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	if original.Status != StatusFailed {
+		return nil, ErrJobNotReplayable
+	}
+	if original.ReplayedAs != nil {
+		return nil, ErrAlreadyReplayed
+	}
+
+	replay := ScheduledJob{
+		JobType:         original.JobType,
+		Payload:         original.Payload,
+		ScheduleTime:    time.Now(),
+		Tags:            original.Tags,
+		TargetUserEmail: original.TargetUserEmail,
+		RequestedBy:     original.RequestedBy,
+		ApprovedBy:      original.ApprovedBy,
+		ApprovalStatus:  original.ApprovalStatus,
+		DryRun:          original.DryRun,
+		PlanID:          original.PlanID,
+		PlanStep:        original.PlanStep,
+		Priority:        original.Priority,
+		BatchID:         original.BatchID,
+		TemplateName:    original.TemplateName,
+		TemplateVersion: original.TemplateVersion,
+		ReplayedFrom:    &original.ID,
+		ReplayedBy:      &opts.ReplayedBy,
+	}
+	if opts.ScheduleTime != nil {
+		replay.ScheduleTime = *opts.ScheduleTime
+	}
+	if opts.Payload != nil && !equalJSON(original.Payload, opts.Payload) {
+		replay.Payload = opts.Payload
+		if replay.ApprovalStatus != ApprovalAutoApproved {
+			replay.ApprovalStatus = ApprovalPending
+			replay.ApprovedBy = nil
+		}
+	}
+
+	if err := insertJob(tx, &replay); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE job_dependencies SET depends_on = $1
+		WHERE depends_on = $2
+		  AND job_id IN (SELECT sp.id FROM scheduled_provisions sp WHERE sp.status = $3)
+	`, replay.ID, original.ID, StatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move dependencies to replay: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit replay: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"id":            replay.ID,
+		"replayed_from": original.ID,
+		"replayed_by":   opts.ReplayedBy,
+	}).Info("Replayed failed job")
+
+	db.notifyWakeup("scheduled_provisions", replay.ID)
+	return &replay, nil
+}
+
+// ---- JobAttempt methods ----
+
+// CreateJobAttempt records the start of an execution attempt.
+func (db *DB) CreateJobAttempt(a *JobAttempt) error {
+	a.ID = uuid.New()
+	a.Status = AttemptRunning
+	if a.StartedAt.IsZero() {
+		a.StartedAt = time.Now()
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO job_attempts (id, job_id, change_request_id, attempt_number, worker_id, status, target_url, started_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, a.ID, a.JobID, a.ChangeRequestID, a.AttemptNumber, a.WorkerID, a.Status, a.TargetURL, a.StartedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create job attempt: %w", err)
+	}
+	return nil
+}
+
+// FinishJobAttempt stores the outcome of an execution attempt.
+func (db *DB) FinishJobAttempt(a *JobAttempt) error {
+	if a.FinishedAt == nil {
+		now := time.Now()
+		a.FinishedAt = &now
+	}
+
+	_, err := db.Exec(`
+		UPDATE job_attempts
+		SET status = $1, target_url = $2, http_status = $3, latency_ms = $4,
+		    response_body = $5, error_message = $6, finished_at = $7
+		WHERE id = $8
+	`, a.Status, a.TargetURL, a.HTTPStatus, a.LatencyMs, a.ResponseBody,
+		a.ErrorMessage, a.FinishedAt, a.ID)
+	if err != nil {
+		return fmt.Errorf("failed to finish job attempt: %w", err)
+	}
+	return nil
+}
+
+// AbandonJobAttempts closes any attempts of a job or change request that are
+// still running, e.g. after the reaper took it back from a dead worker.
+func (db *DB) AbandonJobAttempts(id uuid.UUID, reason string) error {
+	_, err := db.Exec(`
+		UPDATE job_attempts
+		SET status = $1, error_message = $2, finished_at = NOW()
+		WHERE (job_id = $3 OR change_request_id = $3) AND status = $4
+	`, AttemptAbandoned, reason, id, AttemptRunning)
+	if err != nil {
+		return fmt.Errorf("failed to abandon job attempts: %w", err)
+	}
+	return nil
+}
+
+// ListJobAttempts returns every attempt of a job, oldest first.
+func (db *DB) ListJobAttempts(jobID uuid.UUID) ([]JobAttempt, error) {
+	return db.listAttempts("job_id", jobID)
+}
+
+// ListChangeRequestAttempts returns every attempt of a change request,
+// oldest first.
+func (db *DB) ListChangeRequestAttempts(changeRequestID uuid.UUID) ([]JobAttempt, error) {
+	return db.listAttempts("change_request_id", changeRequestID)
+}
+
+// listAttempts returns the attempts whose owner column holds id.
+func (db *DB) listAttempts(owner string, id uuid.UUID) ([]JobAttempt, error) {
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT id, job_id, change_request_id, attempt_number, worker_id, status, target_url,
+		       http_status, latency_ms, response_body, error_message, started_at, finished_at
+		FROM job_attempts
+		WHERE %s = $1
+		ORDER BY started_at ASC
+	`, owner), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job attempts: %w", err)
+	}
+	defer rows.Close()
+
+	attempts := []JobAttempt{}
+	for rows.Next() {
+		var a JobAttempt
+		err := rows.Scan(
+			&a.ID, &a.JobID, &a.ChangeRequestID, &a.AttemptNumber, &a.WorkerID, &a.Status, &a.TargetURL,
+			&a.HTTPStatus, &a.LatencyMs, &a.ResponseBody, &a.ErrorMessage,
+			&a.StartedAt, &a.FinishedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job attempt: %w", err)
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, nil
+}
+
+// ---- ManagedUser methods ----
+
+// ListManagedUsers returns a paginated, optionally filtered list of users.
+func (db *DB) ListManagedUsers(search *string, department *string, status *string, limit, offset int) ([]ManagedUser, error) {
+	query := `
+		SELECT id, email, full_name, given_name, family_name, department, job_title,
+		       manager_email, org_unit_path, is_admin, is_delegated_admin,
+		       is_suspended, google_id, status, metadata, last_synced_at,
+		       created_at, updated_at
+		FROM managed_users
+		WHERE 1=1
+	`
+	args := []interface{}{}
+	n := 0
+
+	if search != nil && *search != "" {
+		n++
+		query += fmt.Sprintf(" AND (email ILIKE $%d OR full_name ILIKE $%d)", n, n)
+		args = append(args, "%"+*search+"%")
 	}
 	if department != nil {
 		n++
@@ -861,7 +2752,8 @@ func (db *DB) CreateChangeRequest(cr *ChangeRequest) error {
 
 const crColumns = `id, request_type, target_user_email, target_user_name, payload,
 	schedule_time, status, requested_by, requested_at, approved_by, approved_at,
-	executed_at, error_message, retry_count, created_at, updated_at`
+	executed_at, error_message, retry_count, created_at, updated_at,
+	claimed_by, lease_expires_at, next_attempt_at, deferred_reason`
 
 func scanChangeRequest(scan func(dest ...interface{}) error) (ChangeRequest, error) {
 	var cr ChangeRequest
@@ -870,6 +2762,7 @@ func scanChangeRequest(scan func(dest ...interface{}) error) (ChangeRequest, err
 		&cr.ScheduleTime, &cr.Status, &cr.RequestedBy, &cr.RequestedAt,
 		&cr.ApprovedBy, &cr.ApprovedAt, &cr.ExecutedAt, &cr.ErrorMessage,
 		&cr.RetryCount, &cr.CreatedAt, &cr.UpdatedAt,
+		&cr.ClaimedBy, &cr.LeaseExpiresAt, &cr.NextAttemptAt, &cr.DeferredReason,
 	)
 	return cr, err
 }
@@ -958,7 +2851,12 @@ func (db *DB) ApproveChangeRequest(id uuid.UUID, approverEmail string) error {
 		INSERT INTO approval_actions (change_request_id, action, actor_email)
 		VALUES ($1, 'approve', $2)
 	`, id, approverEmail)
-	return err
+	if err != nil {
+		return err
+	}
+
+	db.notifyWakeup("change_requests", id)
+	return nil
 }
 
 // RejectChangeRequest marks a change request as rejected.
@@ -1026,3 +2924,214 @@ func (db *DB) GetPendingChangeRequests() ([]ChangeRequest, error) {
 	}
 	return results, nil
 }
+
+// ClaimChangeRequests atomically moves approved change requests that are due
+// to executing under workerID with a lease, unless the job type they map to
+// is paused. Requests the frontend parked as scheduled are left alone: its
+// own runner executes those. A limit of zero or less claims all of them.
+func (db *DB) ClaimChangeRequests(workerID string, lease time.Duration, limit int) ([]ChangeRequest, error) {
+	jobTypes, err := json.Marshal(ChangeRequestJobTypes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode change request job types: %w", err)
+	}
+
+	args := []interface{}{CRStatusApproved, CRStatusExecuting, workerID, lease.Seconds(), string(jobTypes)}
+
+	claimable := `
+		SELECT id FROM change_requests
+		WHERE status = $1
+		  AND (schedule_time IS NULL OR schedule_time <= NOW())
+		  AND (next_attempt_at IS NULL OR next_attempt_at <= NOW())
+		  AND NOT EXISTS (
+			SELECT 1 FROM scheduler_pauses p
+			WHERE p.scope IN ('*', COALESCE($5::jsonb ->> request_type, request_type))
+		  )
+		ORDER BY COALESCE(schedule_time, requested_at) ASC`
+	if limit > 0 {
+		args = append(args, limit)
+		claimable += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	claimable += " FOR UPDATE SKIP LOCKED"
+
+	query := fmt.Sprintf(`
+		UPDATE change_requests
+		SET status = $2, claimed_by = $3,
+		    lease_expires_at = NOW() + $4 * INTERVAL '1 second',
+		    updated_at = NOW()
+		WHERE status = $1 AND id IN (%s)
+		RETURNING %s
+	`, claimable, crColumns)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim change requests: %w", err)
+	}
+	defer rows.Close()
+
+	var results []ChangeRequest
+	for rows.Next() {
+		cr, err := scanChangeRequest(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan change request: %w", err)
+		}
+		results = append(results, cr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim change requests: %w", err)
+	}
+
+	return results, nil
+}
+
+// FinishChangeRequest moves a change request claimed by workerID out of
+// executing and releases the claim. It returns ErrJobNotClaimed if the
+// worker no longer owns the request.
+func (db *DB) FinishChangeRequest(id uuid.UUID, workerID string, status string, errorMsg *string) error {
+	now := time.Now()
+	var executedAt *time.Time
+	if status == CRStatusCompleted || status == CRStatusFailed {
+		executedAt = &now
+	}
+
+	res, err := db.Exec(`
+		UPDATE change_requests
+		SET status=$1, executed_at=$2, error_message=$3, updated_at=$4,
+		    claimed_by=NULL, lease_expires_at=NULL
+		WHERE id=$5 AND claimed_by=$6 AND status=$7
+	`, status, executedAt, errorMsg, now, id, workerID, CRStatusExecuting)
+	if err != nil {
+		return fmt.Errorf("failed to finish change request: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrJobNotClaimed
+	}
+	return nil
+}
+
+// RetryChangeRequest returns a change request claimed by workerID to
+// approved, bumps its retry count and holds it back until nextAttempt.
+func (db *DB) RetryChangeRequest(id uuid.UUID, workerID string, errorMsg string, nextAttempt time.Time) error {
+	res, err := db.Exec(`
+		UPDATE change_requests
+		SET status=$1, error_message=$2, retry_count=retry_count+1,
+		    next_attempt_at=$3, updated_at=NOW(),
+		    claimed_by=NULL, lease_expires_at=NULL
+		WHERE id=$4 AND claimed_by=$5 AND status=$6
+	`, CRStatusApproved, errorMsg, nextAttempt, id, workerID, CRStatusExecuting)
+	if err != nil {
+		return fmt.Errorf("failed to schedule change request retry: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrJobNotClaimed
+	}
+	db.notifyWakeup("change_requests", id)
+	return nil
+}
+
+// DeferChangeRequest returns a change request claimed by workerID to
+// approved without counting an attempt, holding it back until the given time.
+func (db *DB) DeferChangeRequest(id uuid.UUID, workerID string, until time.Time, reason string) error {
+	res, err := db.Exec(`
+		UPDATE change_requests
+		SET status=$1, next_attempt_at=$2, deferred_reason=$3, updated_at=NOW(),
+		    claimed_by=NULL, lease_expires_at=NULL
+		WHERE id=$4 AND claimed_by=$5 AND status=$6
+	`, CRStatusApproved, until, reason, id, workerID, CRStatusExecuting)
+	if err != nil {
+		return fmt.Errorf("failed to defer change request: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrJobNotClaimed
+	}
+	db.notifyWakeup("change_requests", id)
+	return nil
+}
+
+// RenewChangeRequestLease extends the lease on a change request this worker
+// is executing. It returns ErrJobNotClaimed if the claim was lost.
+func (db *DB) RenewChangeRequestLease(id uuid.UUID, workerID string, lease time.Duration) error {
+	res, err := db.Exec(`
+		UPDATE change_requests
+		SET lease_expires_at = NOW() + $1 * INTERVAL '1 second'
+		WHERE id = $2 AND claimed_by = $3 AND status = $4
+	`, lease.Seconds(), id, workerID, CRStatusExecuting)
+	if err != nil {
+		return fmt.Errorf("failed to renew change request lease: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrJobNotClaimed
+	}
+	return nil
+}
+
+// GetExpiredChangeRequestLeases returns change requests claimed by a
+// scheduler worker whose lease has run out.
+func (db *DB) GetExpiredChangeRequestLeases() ([]ChangeRequest, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM change_requests
+		WHERE status = $1 AND claimed_by IS NOT NULL AND lease_expires_at < NOW()
+		ORDER BY lease_expires_at ASC
+	`, crColumns)
+
+	rows, err := db.Query(query, CRStatusExecuting)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired change request leases: %w", err)
+	}
+	defer rows.Close()
+
+	var results []ChangeRequest
+	for rows.Next() {
+		cr, err := scanChangeRequest(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan change request: %w", err)
+		}
+		results = append(results, cr)
+	}
+	return results, nil
+}
+
+// ReapChangeRequest takes back a change request whose lease expired, moving
+// it to status (approved for another attempt, or failed). It only applies if
+// the request is still held under the same claim and lease.
+func (db *DB) ReapChangeRequest(cr ChangeRequest, status string, reason string, nextAttempt *time.Time) (bool, error) {
+	var executedAt *time.Time
+	if status == CRStatusFailed {
+		now := time.Now()
+		executedAt = &now
+	}
+
+	res, err := db.Exec(`
+		UPDATE change_requests
+		SET status=$1, error_message=$2, next_attempt_at=$3, executed_at=$4,
+		    retry_count=retry_count+1, updated_at=NOW(),
+		    claimed_by=NULL, lease_expires_at=NULL
+		WHERE id=$5 AND status=$6 AND claimed_by=$7 AND lease_expires_at=$8
+	`, status, reason, nextAttempt, executedAt, cr.ID, CRStatusExecuting, cr.ClaimedBy, cr.LeaseExpiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to reap change request: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected > 0 && status == CRStatusApproved {
+		db.notifyWakeup("change_requests", cr.ID)
+	}
+	return affected > 0, nil
+}
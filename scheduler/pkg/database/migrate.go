@@ -0,0 +1,469 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// migrationFiles holds the schema migrations: for every version a file
+// NNNN_name.up.sql and, if the migration can be reverted, NNNN_name.down.sql.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the Postgres advisory lock held while migrating, so
+// replicas starting at the same time apply each migration once.
+const migrationLockID int64 = 0x6f6e65636c69636b // "oneclick"
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// ErrMigrationModified is returned when the SQL of an applied migration no
+// longer matches the checksum recorded when it was applied.
+var ErrMigrationModified = errors.New("applied migration was modified")
+
+// ErrIrreversibleMigration is returned when reverting a migration that has
+// no down migration.
+var ErrIrreversibleMigration = errors.New("migration cannot be reverted")
+
+// Migration is one versioned schema change.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string // empty if the migration cannot be reverted
+	Checksum string // hex SHA-256 of Up
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// MigrationState describes a migration and whether it was applied.
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	// Modified is set if the migration changed after it was applied.
+	Modified bool
+	// Unknown is set for an applied migration this build does not have,
+	// e.g. one applied by a newer release.
+	Unknown bool
+}
+
+// appliedMigration is a row of schema_migrations.
+type appliedMigration struct {
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// legacyMarkers identify how far a database set up before schema_migrations
+// existed got: each is a table or column added by that migration.
+var legacyMarkers = []struct {
+	version int
+	table   string
+	column  string // empty to look for the table itself
+}{
+	{1, "scheduled_provisions", ""},
+	{2, "scheduled_provisions", "job_type"},
+	{3, "scheduled_provisions", "approval_status"},
+	{4, "change_requests", ""},
+	{5, "scheduled_provisions", "claimed_by"},
+	{6, "scheduled_provisions", "next_attempt_at"},
+	{7, "job_attempts", ""},
+	{8, "change_requests", "claimed_by"},
+	{9, "scheduled_provisions", "deferred_reason"},
+	{10, "scheduled_provisions", "idempotency_key"},
+	{11, "scheduled_provisions", "callback_token"},
+	{12, "scheduled_provisions", "cancelled_by"},
+	{13, "job_edits", ""},
+	{14, "scheduler_pauses", ""},
+	{15, "scheduled_provisions", "dry_run"},
+	{16, "job_plans", ""},
+	{17, "recurring_jobs", ""},
+	{18, "scheduled_provisions", "failure_reason"},
+	{19, "scheduled_provisions", "priority"},
+	{20, "job_batches", ""},
+	{21, "job_templates", ""},
+}
+
+// LoadMigrations returns the embedded migrations ordered by version.
+func LoadMigrations() ([]Migration, error) {
+	dir, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	return loadMigrations(dir)
+}
+
+// loadMigrations reads the migration files at the root of fsys.
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %s has no up migration", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration in order, each in its own
+// transaction, and returns how many were applied. It refuses to run if an
+// applied migration was modified since.
+func (db *DB) MigrateUp() (int, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	err = db.withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		if err := baselineLegacySchema(ctx, conn, migrations); err != nil {
+			return err
+		}
+
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := verifyMigrations(migrations, done); err != nil {
+			return err
+		}
+
+		known := map[int]bool{}
+		for _, m := range migrations {
+			known[m.Version] = true
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, m, true); err != nil {
+				return err
+			}
+			log.Infof("Applied migration %s", m)
+			applied++
+		}
+		for version, row := range done {
+			if !known[version] {
+				log.Warnf("Database has migration %04d_%s which this release does not know", version, row.Name)
+			}
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first, and
+// returns how many were reverted. It stops with ErrIrreversibleMigration at
+// a migration without a down migration.
+func (db *DB) MigrateDown(steps int) (int, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	byVersion := map[int]Migration{}
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	reverted := 0
+	err = db.withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		versions := make([]int, 0, len(done))
+		for version := range done {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		for _, version := range versions {
+			if reverted == steps {
+				break
+			}
+			m, ok := byVersion[version]
+			if !ok {
+				return fmt.Errorf("migration %04d_%s is unknown to this release", version, done[version].Name)
+			}
+			if done[version].Checksum != m.Checksum {
+				return fmt.Errorf("%w: %s", ErrMigrationModified, m)
+			}
+			if m.Down == "" {
+				return fmt.Errorf("%w: %s has no down migration", ErrIrreversibleMigration, m)
+			}
+			if err := runMigration(ctx, conn, m, false); err != nil {
+				return err
+			}
+			log.Infof("Reverted migration %s", m)
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatus lists every known migration and whether it was applied,
+// followed by applied migrations this build does not know.
+func (db *DB) MigrationStatus() ([]MigrationState, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	done := map[int]appliedMigration{}
+	var tracked bool
+	if err := db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&tracked); err != nil {
+		return nil, fmt.Errorf("failed to check for schema_migrations: %w", err)
+	}
+	if tracked {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get connection: %w", err)
+		}
+		defer conn.Close()
+		if done, err = appliedMigrations(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	known := map[int]bool{}
+	for _, m := range migrations {
+		known[m.Version] = true
+		state := MigrationState{Version: m.Version, Name: m.Name}
+		if row, ok := done[m.Version]; ok {
+			appliedAt := row.AppliedAt
+			state.AppliedAt = &appliedAt
+			state.Modified = row.Checksum != m.Checksum
+		}
+		states = append(states, state)
+	}
+
+	var unknown []MigrationState
+	for version, row := range done {
+		if known[version] {
+			continue
+		}
+		appliedAt := row.AppliedAt
+		unknown = append(unknown, MigrationState{Version: version, Name: row.Name, AppliedAt: &appliedAt, Unknown: true})
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+
+	return append(states, unknown...), nil
+}
+
+// withMigrationLock runs fn on a dedicated connection holding the migration
+// advisory lock, after making sure schema_migrations exists.
+func (db *DB) withMigrationLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, migrationLockID).Scan(&locked); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	if !locked {
+		log.Info("Waiting for another process to finish migrating")
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID); err != nil {
+			log.Warnf("Failed to release migration lock: %v", err)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	return fn(ctx, conn)
+}
+
+// appliedMigrations returns the rows of schema_migrations by version.
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	done := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var row appliedMigration
+		if err := rows.Scan(&version, &row.Name, &row.Checksum, &row.AppliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		done[version] = row
+	}
+	return done, rows.Err()
+}
+
+// verifyMigrations checks that no applied migration was modified.
+func verifyMigrations(migrations []Migration, done map[int]appliedMigration) error {
+	for _, m := range migrations {
+		if row, ok := done[m.Version]; ok && row.Checksum != m.Checksum {
+			return fmt.Errorf("%w: %s no longer matches the checksum recorded on %s; add a new migration instead of editing it",
+				ErrMigrationModified, m, row.AppliedAt.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// runMigration applies (up) or reverts m and records it in
+// schema_migrations, in one transaction.
+func runMigration(ctx context.Context, conn *sql.Conn, m Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if up {
+		if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", m, err)
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+			m.Version, m.Name, m.Checksum,
+		)
+	} else {
+		if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+			return fmt.Errorf("failed to revert migration %s: %w", m, err)
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", m, err)
+	}
+
+	return tx.Commit()
+}
+
+// baselineLegacySchema marks as applied the migrations that a database set
+// up before schema_migrations existed already has, going by legacyMarkers,
+// so they are not run again: the constraint rewrites in early migrations
+// would reject rows written since.
+func baselineLegacySchema(ctx context.Context, conn *sql.Conn, migrations []Migration) error {
+	var tracked, legacy bool
+	err := conn.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM schema_migrations),
+		       to_regclass('scheduled_provisions') IS NOT NULL
+	`).Scan(&tracked, &legacy)
+	if err != nil {
+		return fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	if tracked || !legacy {
+		return nil
+	}
+
+	baseline := 0
+	for i := len(legacyMarkers) - 1; i >= 0 && baseline == 0; i-- {
+		marker := legacyMarkers[i]
+		var present bool
+		if marker.column == "" {
+			err = conn.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, marker.table).Scan(&present)
+		} else {
+			err = conn.QueryRowContext(ctx, `
+				SELECT EXISTS (
+					SELECT 1 FROM information_schema.columns
+					WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2
+				)
+			`, marker.table, marker.column).Scan(&present)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to inspect schema: %w", err)
+		}
+		if present {
+			baseline = marker.version
+		}
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, m := range migrations {
+		if m.Version > baseline {
+			break
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+			m.Version, m.Name, m.Checksum,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", m, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit baseline: %w", err)
+	}
+
+	log.Infof("Existing schema predates schema_migrations; recorded migrations up to %04d as applied", baseline)
+	return nil
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func checksum(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []Migration
+		wantErr string
+	}{
+		{
+			name: "ordered by version, not by file name",
+			files: fstest.MapFS{
+				"10_tenth.up.sql":   file("CREATE TABLE ten ();"),
+				"10_tenth.down.sql": file("DROP TABLE ten;"),
+				"9_ninth.up.sql":    file("CREATE TABLE nine ();"),
+				"0001_first.up.sql": file("CREATE TABLE one ();"),
+			},
+			want: []Migration{
+				{Version: 1, Name: "first", Up: "CREATE TABLE one ();"},
+				{Version: 9, Name: "ninth", Up: "CREATE TABLE nine ();"},
+				{Version: 10, Name: "tenth", Up: "CREATE TABLE ten ();", Down: "DROP TABLE ten;"},
+			},
+		},
+		{
+			name:  "empty",
+			files: fstest.MapFS{},
+			want:  []Migration{},
+		},
+		{
+			name: "down without up",
+			files: fstest.MapFS{
+				"0001_first.up.sql":    file("CREATE TABLE one ();"),
+				"0002_second.down.sql": file("DROP TABLE two;"),
+			},
+			wantErr: "migration 0002_second has no up migration",
+		},
+		{
+			name: "two names for one version",
+			files: fstest.MapFS{
+				"0003_third.up.sql":     file("CREATE TABLE three ();"),
+				"0003_renamed.down.sql": file("DROP TABLE three;"),
+			},
+			wantErr: "migration 3 has two names",
+		},
+		{
+			name: "unexpected file",
+			files: fstest.MapFS{
+				"0001_first.up.sql": file("CREATE TABLE one ();"),
+				"README.md":         file("notes"),
+			},
+			wantErr: "unexpected migration file README.md",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadMigrations(tt.files)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadMigrations() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadMigrations() error: %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("loadMigrations() returned %d migrations, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, m := range got {
+				want := tt.want[i]
+				want.Checksum = checksum(want.Up)
+				if m != want {
+					t.Errorf("migration %d = %+v, want %+v", i, m, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("LoadMigrations() error: %v", err)
+	}
+
+	irreversible := map[int]bool{1: true, 2: true, 3: true, 4: true}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("migration %s found where version %d was expected; versions must be contiguous", m, i+1)
+		}
+		if m.Down == "" && !irreversible[m.Version] {
+			t.Errorf("migration %s has no down migration", m)
+		}
+		if m.Down != "" && irreversible[m.Version] {
+			t.Errorf("migration %s is expected to be irreversible but has a down migration", m)
+		}
+	}
+
+	if last := legacyMarkers[len(legacyMarkers)-1].version; last > len(migrations) {
+		t.Errorf("legacyMarkers refers to migration %d, but only %d exist", last, len(migrations))
+	}
+}
+
+func TestVerifyMigrations(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "first", Up: "CREATE TABLE one ();", Checksum: checksum("CREATE TABLE one ();")},
+		{Version: 2, Name: "second", Up: "CREATE TABLE two ();", Checksum: checksum("CREATE TABLE two ();")},
+	}
+	appliedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		done     map[int]appliedMigration
+		modified bool
+	}{
+		{
+			name: "nothing applied",
+			done: map[int]appliedMigration{},
+		},
+		{
+			name: "applied migrations unchanged",
+			done: map[int]appliedMigration{
+				1: {Name: "first", Checksum: checksum("CREATE TABLE one ();"), AppliedAt: appliedAt},
+				2: {Name: "second", Checksum: checksum("CREATE TABLE two ();"), AppliedAt: appliedAt},
+			},
+		},
+		{
+			name: "unknown applied migration is not an error",
+			done: map[int]appliedMigration{
+				1: {Name: "first", Checksum: checksum("CREATE TABLE one ();"), AppliedAt: appliedAt},
+				3: {Name: "third", Checksum: checksum("CREATE TABLE three ();"), AppliedAt: appliedAt},
+			},
+		},
+		{
+			name: "applied migration edited",
+			done: map[int]appliedMigration{
+				1: {Name: "first", Checksum: checksum("CREATE TABLE one ();"), AppliedAt: appliedAt},
+				2: {Name: "second", Checksum: checksum("CREATE TABLE deux ();"), AppliedAt: appliedAt},
+			},
+			modified: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyMigrations(migrations, tt.done)
+			if tt.modified {
+				if !errors.Is(err, ErrMigrationModified) {
+					t.Fatalf("verifyMigrations() error = %v, want ErrMigrationModified", err)
+				}
+				if !strings.Contains(err.Error(), "0002_second") {
+					t.Errorf("verifyMigrations() error %q does not name the migration", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyMigrations() error: %v", err)
+			}
+		})
+	}
+}
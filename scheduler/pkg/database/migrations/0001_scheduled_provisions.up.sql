@@ -0,0 +1,20 @@
+-- Scheduled provisions
+
+CREATE TABLE IF NOT EXISTS scheduled_provisions (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	employee_data JSONB NOT NULL,
+	applications JSONB NOT NULL,
+	schedule_time TIMESTAMP WITH TIME ZONE NOT NULL,
+	status VARCHAR(50) NOT NULL DEFAULT 'pending',
+	tags TEXT[] NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	executed_at TIMESTAMP WITH TIME ZONE,
+	error_message TEXT,
+	retry_count INTEGER DEFAULT 0,
+	CONSTRAINT valid_status CHECK (status IN ('pending', 'executing', 'completed', 'failed', 'cancelled'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedule_time ON scheduled_provisions(schedule_time) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_tags ON scheduled_provisions USING GIN(tags);
+CREATE INDEX IF NOT EXISTS idx_status ON scheduled_provisions(status);
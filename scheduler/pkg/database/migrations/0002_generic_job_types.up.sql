@@ -0,0 +1,7 @@
+-- Extend table to support generic job types
+
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS job_type VARCHAR(20) NOT NULL DEFAULT 'provision';
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS payload JSONB;
+ALTER TABLE scheduled_provisions DROP CONSTRAINT IF EXISTS valid_job_type;
+ALTER TABLE scheduled_provisions ADD CONSTRAINT valid_job_type CHECK (job_type IN ('provision', 'terminate'));
+CREATE INDEX IF NOT EXISTS idx_job_type ON scheduled_provisions(job_type);
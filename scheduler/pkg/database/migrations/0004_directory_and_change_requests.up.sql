@@ -0,0 +1,92 @@
+-- Managed_users, directory sync, and change requests tables
+
+CREATE TABLE IF NOT EXISTS managed_users (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	email VARCHAR(255) NOT NULL UNIQUE,
+	full_name VARCHAR(255) NOT NULL,
+	given_name VARCHAR(128),
+	family_name VARCHAR(128),
+	department VARCHAR(255),
+	job_title VARCHAR(255),
+	manager_email VARCHAR(255),
+	org_unit_path VARCHAR(512),
+	is_admin BOOLEAN DEFAULT false,
+	is_delegated_admin BOOLEAN DEFAULT false,
+	is_suspended BOOLEAN DEFAULT false,
+	google_id VARCHAR(255) UNIQUE,
+	status VARCHAR(50) NOT NULL DEFAULT 'active',
+	metadata JSONB DEFAULT '{}'::jsonb,
+	last_synced_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_managed_users_email ON managed_users(email);
+CREATE INDEX IF NOT EXISTS idx_managed_users_status ON managed_users(status);
+CREATE INDEX IF NOT EXISTS idx_managed_users_department ON managed_users(department);
+CREATE INDEX IF NOT EXISTS idx_managed_users_google_id ON managed_users(google_id);
+
+CREATE TABLE IF NOT EXISTS user_app_accounts (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	managed_user_id UUID NOT NULL REFERENCES managed_users(id) ON DELETE CASCADE,
+	app_provider VARCHAR(50) NOT NULL,
+	status VARCHAR(50) NOT NULL DEFAULT 'not_provisioned',
+	external_user_id VARCHAR(255),
+	external_email VARCHAR(255),
+	license_info JSONB DEFAULT '[]'::jsonb,
+	groups_info JSONB DEFAULT '[]'::jsonb,
+	role_info JSONB DEFAULT '{}'::jsonb,
+	metadata JSONB DEFAULT '{}'::jsonb,
+	provisioned_at TIMESTAMP WITH TIME ZONE,
+	last_modified_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	UNIQUE(managed_user_id, app_provider)
+);
+CREATE INDEX IF NOT EXISTS idx_user_app_accounts_user ON user_app_accounts(managed_user_id);
+CREATE INDEX IF NOT EXISTS idx_user_app_accounts_provider ON user_app_accounts(app_provider);
+
+CREATE TABLE IF NOT EXISTS directory_sync_runs (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	status VARCHAR(20) NOT NULL DEFAULT 'running',
+	users_synced INTEGER DEFAULT 0,
+	users_added INTEGER DEFAULT 0,
+	users_updated INTEGER DEFAULT 0,
+	users_removed INTEGER DEFAULT 0,
+	errors JSONB DEFAULT '[]'::jsonb,
+	started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	completed_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS idx_sync_runs_started ON directory_sync_runs(started_at DESC);
+
+CREATE TABLE IF NOT EXISTS change_requests (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	request_type VARCHAR(30) NOT NULL,
+	target_user_email VARCHAR(255) NOT NULL,
+	target_user_name VARCHAR(255),
+	payload JSONB NOT NULL,
+	schedule_time TIMESTAMP WITH TIME ZONE,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending_approval',
+	requested_by VARCHAR(255) NOT NULL,
+	requested_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	approved_by VARCHAR(255),
+	approved_at TIMESTAMP WITH TIME ZONE,
+	executed_at TIMESTAMP WITH TIME ZONE,
+	error_message TEXT,
+	retry_count INTEGER DEFAULT 0,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_cr_status ON change_requests(status);
+CREATE INDEX IF NOT EXISTS idx_cr_type ON change_requests(request_type);
+CREATE INDEX IF NOT EXISTS idx_cr_target ON change_requests(target_user_email);
+CREATE INDEX IF NOT EXISTS idx_cr_requested_by ON change_requests(requested_by);
+
+CREATE TABLE IF NOT EXISTS approval_actions (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	change_request_id UUID NOT NULL REFERENCES change_requests(id) ON DELETE CASCADE,
+	action VARCHAR(10) NOT NULL,
+	actor_email VARCHAR(255) NOT NULL,
+	reason TEXT,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_approval_actions_request ON approval_actions(change_request_id);
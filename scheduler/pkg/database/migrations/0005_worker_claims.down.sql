@@ -0,0 +1,4 @@
+-- Worker claims so multiple scheduler replicas can run safely (revert)
+
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS lease_expires_at;
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS claimed_by;
@@ -0,0 +1,5 @@
+-- Worker claims so multiple scheduler replicas can run safely
+
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS claimed_by VARCHAR(255);
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_lease_expires ON scheduled_provisions(lease_expires_at) WHERE status = 'executing';
@@ -0,0 +1,3 @@
+-- Retry backoff (revert)
+
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS next_attempt_at;
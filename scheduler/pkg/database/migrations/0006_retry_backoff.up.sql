@@ -0,0 +1,4 @@
+-- Retry backoff
+
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_next_attempt ON scheduled_provisions(next_attempt_at) WHERE status = 'pending';
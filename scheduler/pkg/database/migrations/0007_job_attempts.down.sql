@@ -0,0 +1,3 @@
+-- Per-attempt execution history (revert)
+
+DROP TABLE IF EXISTS job_attempts;
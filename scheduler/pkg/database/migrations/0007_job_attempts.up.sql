@@ -0,0 +1,18 @@
+-- Per-attempt execution history
+
+CREATE TABLE IF NOT EXISTS job_attempts (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	job_id UUID NOT NULL REFERENCES scheduled_provisions(id) ON DELETE CASCADE,
+	attempt_number INTEGER NOT NULL,
+	worker_id VARCHAR(255) NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'running',
+	target_url TEXT,
+	http_status INTEGER,
+	latency_ms BIGINT,
+	response_body TEXT,
+	error_message TEXT,
+	started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	finished_at TIMESTAMP WITH TIME ZONE,
+	CONSTRAINT valid_attempt_status CHECK (status IN ('running', 'succeeded', 'failed', 'abandoned'))
+);
+CREATE INDEX IF NOT EXISTS idx_job_attempts_job ON job_attempts(job_id, started_at);
@@ -0,0 +1,5 @@
+-- Claims, leases and backoff for change request execution (revert)
+
+ALTER TABLE change_requests DROP COLUMN IF EXISTS next_attempt_at;
+ALTER TABLE change_requests DROP COLUMN IF EXISTS lease_expires_at;
+ALTER TABLE change_requests DROP COLUMN IF EXISTS claimed_by;
@@ -0,0 +1,6 @@
+-- Claims, leases and backoff for change request execution
+
+ALTER TABLE change_requests ADD COLUMN IF NOT EXISTS claimed_by VARCHAR(255);
+ALTER TABLE change_requests ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE change_requests ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_cr_lease_expires ON change_requests(lease_expires_at) WHERE status = 'executing';
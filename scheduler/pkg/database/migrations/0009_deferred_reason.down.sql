@@ -0,0 +1,4 @@
+-- Record why a due job was held back by the execution calendar (revert)
+
+ALTER TABLE change_requests DROP COLUMN IF EXISTS deferred_reason;
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS deferred_reason;
@@ -0,0 +1,4 @@
+-- Record why a due job was held back by the execution calendar
+
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS deferred_reason TEXT;
+ALTER TABLE change_requests ADD COLUMN IF NOT EXISTS deferred_reason TEXT;
@@ -0,0 +1,4 @@
+-- Idempotency keys for job creation (revert)
+
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS request_hash;
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS idempotency_key;
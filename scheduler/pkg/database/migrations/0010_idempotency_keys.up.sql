@@ -0,0 +1,5 @@
+-- Idempotency keys for job creation
+
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255);
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS request_hash VARCHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_key ON scheduled_provisions(idempotency_key) WHERE idempotency_key IS NOT NULL;
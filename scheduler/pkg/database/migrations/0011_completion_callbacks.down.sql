@@ -0,0 +1,18 @@
+-- Asynchronous completion callbacks (revert)
+--
+-- Jobs still waiting for a callback have no status without this migration.
+-- Their outcome is unknown, so they are failed rather than completed.
+
+UPDATE scheduled_provisions
+SET status = 'failed',
+    error_message = 'callback not received before migration 0011 was reverted',
+    updated_at = NOW()
+WHERE status = 'awaiting_callback';
+
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS callback_result;
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS callback_deadline;
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS callback_token;
+ALTER TABLE scheduled_provisions DROP CONSTRAINT IF EXISTS valid_status;
+ALTER TABLE scheduled_provisions ADD CONSTRAINT valid_status CHECK (
+	status IN ('pending', 'executing', 'completed', 'failed', 'cancelled')
+);
@@ -0,0 +1,11 @@
+-- Asynchronous completion callbacks
+
+ALTER TABLE scheduled_provisions DROP CONSTRAINT IF EXISTS valid_status;
+ALTER TABLE scheduled_provisions ADD CONSTRAINT valid_status CHECK (
+	status IN ('pending', 'executing', 'awaiting_callback', 'completed', 'failed', 'cancelled')
+);
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS callback_token VARCHAR(128);
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS callback_deadline TIMESTAMP WITH TIME ZONE;
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS callback_result JSONB;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_callback_token ON scheduled_provisions(callback_token) WHERE callback_token IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_callback_deadline ON scheduled_provisions(callback_deadline) WHERE status = 'awaiting_callback';
@@ -0,0 +1,9 @@
+-- Cancellation of executing jobs (revert)
+
+ALTER TABLE job_attempts DROP CONSTRAINT IF EXISTS valid_attempt_status;
+ALTER TABLE job_attempts ADD CONSTRAINT valid_attempt_status CHECK (
+	status IN ('running', 'succeeded', 'failed', 'abandoned')
+);
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS cancelled_at;
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS cancelled_by;
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS cancel_requested_at;
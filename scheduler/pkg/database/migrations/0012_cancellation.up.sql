@@ -0,0 +1,9 @@
+-- Cancellation of executing jobs
+
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS cancel_requested_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS cancelled_by VARCHAR(255);
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE job_attempts DROP CONSTRAINT IF EXISTS valid_attempt_status;
+ALTER TABLE job_attempts ADD CONSTRAINT valid_attempt_status CHECK (
+	status IN ('running', 'succeeded', 'failed', 'abandoned', 'cancelled')
+);
@@ -0,0 +1,3 @@
+-- Edit history for pending jobs (revert)
+
+DROP TABLE IF EXISTS job_edits;
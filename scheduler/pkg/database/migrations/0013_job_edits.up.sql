@@ -0,0 +1,11 @@
+-- Edit history for pending jobs
+
+CREATE TABLE IF NOT EXISTS job_edits (
+	id UUID PRIMARY KEY,
+	job_id UUID NOT NULL REFERENCES scheduled_provisions(id) ON DELETE CASCADE,
+	edited_by VARCHAR(255),
+	edited_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	changes JSONB NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_edits_job ON job_edits(job_id, edited_at);
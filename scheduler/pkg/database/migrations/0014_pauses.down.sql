@@ -0,0 +1,4 @@
+-- Pause switches and their audit trail (revert)
+
+DROP TABLE IF EXISTS scheduler_pause_events;
+DROP TABLE IF EXISTS scheduler_pauses;
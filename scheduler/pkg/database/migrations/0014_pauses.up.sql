@@ -0,0 +1,18 @@
+-- Pause switches and their audit trail
+
+CREATE TABLE IF NOT EXISTS scheduler_pauses (
+	scope VARCHAR(50) PRIMARY KEY,
+	reason TEXT NOT NULL,
+	paused_by VARCHAR(255) NOT NULL,
+	paused_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS scheduler_pause_events (
+	id BIGSERIAL PRIMARY KEY,
+	scope VARCHAR(50) NOT NULL,
+	action VARCHAR(10) NOT NULL,
+	actor VARCHAR(255) NOT NULL,
+	reason TEXT,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	CONSTRAINT valid_pause_action CHECK (action IN ('pause', 'resume'))
+);
@@ -0,0 +1,16 @@
+-- Dry-run jobs (revert)
+--
+-- Finished dry runs have no status without this migration. They never
+-- executed anything, so they are cancelled rather than completed.
+
+UPDATE scheduled_provisions
+SET status = 'cancelled',
+    error_message = COALESCE(error_message, 'dry run; cancelled when migration 0015 was reverted'),
+    updated_at = NOW()
+WHERE status = 'completed_dry_run';
+
+ALTER TABLE scheduled_provisions DROP CONSTRAINT IF EXISTS valid_status;
+ALTER TABLE scheduled_provisions ADD CONSTRAINT valid_status CHECK (
+	status IN ('pending', 'executing', 'awaiting_callback', 'completed', 'failed', 'cancelled')
+);
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS dry_run;
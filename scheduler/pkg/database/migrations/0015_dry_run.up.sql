@@ -0,0 +1,7 @@
+-- Dry-run jobs
+
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS dry_run BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE scheduled_provisions DROP CONSTRAINT IF EXISTS valid_status;
+ALTER TABLE scheduled_provisions ADD CONSTRAINT valid_status CHECK (
+	status IN ('pending', 'executing', 'awaiting_callback', 'completed', 'completed_dry_run', 'failed', 'cancelled')
+);
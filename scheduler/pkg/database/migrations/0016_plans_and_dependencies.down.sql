@@ -0,0 +1,6 @@
+-- Job dependencies and multi-step plans (revert)
+
+DROP TABLE IF EXISTS job_dependencies;
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS plan_step;
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS plan_id;
+DROP TABLE IF EXISTS job_plans;
@@ -0,0 +1,23 @@
+-- Job dependencies and multi-step plans
+
+CREATE TABLE IF NOT EXISTS job_plans (
+	id UUID PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	target_user_email VARCHAR(255),
+	start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_by VARCHAR(255),
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	cancelled_at TIMESTAMP WITH TIME ZONE,
+	cancelled_by VARCHAR(255)
+);
+
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS plan_id UUID REFERENCES job_plans(id);
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS plan_step VARCHAR(100);
+CREATE INDEX IF NOT EXISTS idx_plan_id ON scheduled_provisions(plan_id) WHERE plan_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS job_dependencies (
+	job_id UUID NOT NULL REFERENCES scheduled_provisions(id) ON DELETE CASCADE,
+	depends_on UUID NOT NULL REFERENCES scheduled_provisions(id) ON DELETE CASCADE,
+	PRIMARY KEY (job_id, depends_on)
+);
+CREATE INDEX IF NOT EXISTS idx_job_dependencies_depends_on ON job_dependencies(depends_on);
@@ -0,0 +1,4 @@
+-- Recurring job definitions (revert)
+
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS recurring_job_id;
+DROP TABLE IF EXISTS recurring_jobs;
@@ -0,0 +1,28 @@
+-- Recurring job definitions
+
+CREATE TABLE IF NOT EXISTS recurring_jobs (
+	id UUID PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	job_type VARCHAR(50) NOT NULL,
+	payload JSONB NOT NULL,
+	tags TEXT[] NOT NULL DEFAULT '{}',
+	target_user_email VARCHAR(255),
+	requested_by VARCHAR(255),
+	schedule TEXT NOT NULL,
+	timezone VARCHAR(64) NOT NULL,
+	start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+	end_time TIMESTAMP WITH TIME ZONE,
+	paused BOOLEAN NOT NULL DEFAULT FALSE,
+	paused_by VARCHAR(255),
+	paused_at TIMESTAMP WITH TIME ZONE,
+	materialized_until TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	deleted_at TIMESTAMP WITH TIME ZONE,
+	deleted_by VARCHAR(255)
+);
+
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS recurring_job_id UUID REFERENCES recurring_jobs(id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_recurring_occurrence
+	ON scheduled_provisions(recurring_job_id, schedule_time)
+	WHERE recurring_job_id IS NOT NULL AND status <> 'cancelled';
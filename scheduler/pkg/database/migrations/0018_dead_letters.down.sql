@@ -0,0 +1,6 @@
+-- Failure reasons, replay links and the dead-letter view (revert)
+
+DROP VIEW IF EXISTS dead_letter_jobs;
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS replayed_by;
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS replayed_from;
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS failure_reason;
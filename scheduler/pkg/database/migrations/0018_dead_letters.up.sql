@@ -0,0 +1,15 @@
+-- Failure reasons, replay links and the dead-letter view
+
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS failure_reason VARCHAR(50);
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS replayed_from UUID REFERENCES scheduled_provisions(id);
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS replayed_by VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_replayed_from
+	ON scheduled_provisions(replayed_from) WHERE replayed_from IS NOT NULL;
+
+CREATE OR REPLACE VIEW dead_letter_jobs AS
+SELECT sp.id, sp.job_type, sp.payload, sp.tags, sp.target_user_email, sp.requested_by,
+       sp.schedule_time, sp.executed_at AS failed_at, sp.retry_count,
+       sp.failure_reason, sp.error_message, sp.plan_id, sp.recurring_job_id
+FROM scheduled_provisions sp
+WHERE sp.status = 'failed'
+  AND NOT EXISTS (SELECT 1 FROM scheduled_provisions r WHERE r.replayed_from = sp.id);
@@ -0,0 +1,3 @@
+-- Job priority (revert)
+
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,5 @@
+-- Job priority
+
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_pending_priority
+	ON scheduled_provisions(priority DESC, schedule_time) WHERE status = 'pending';
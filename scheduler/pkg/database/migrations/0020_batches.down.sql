@@ -0,0 +1,13 @@
+-- Bulk job batches (revert)
+
+DROP VIEW IF EXISTS dead_letter_jobs;
+CREATE VIEW dead_letter_jobs AS
+SELECT sp.id, sp.job_type, sp.payload, sp.tags, sp.target_user_email, sp.requested_by,
+       sp.schedule_time, sp.executed_at AS failed_at, sp.retry_count,
+       sp.failure_reason, sp.error_message, sp.plan_id, sp.recurring_job_id
+FROM scheduled_provisions sp
+WHERE sp.status = 'failed'
+  AND NOT EXISTS (SELECT 1 FROM scheduled_provisions r WHERE r.replayed_from = sp.id);
+
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS batch_id;
+DROP TABLE IF EXISTS job_batches;
@@ -0,0 +1,21 @@
+-- Bulk job batches
+
+CREATE TABLE IF NOT EXISTS job_batches (
+	id UUID PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	created_by VARCHAR(255),
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	cancelled_at TIMESTAMP WITH TIME ZONE,
+	cancelled_by VARCHAR(255)
+);
+
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS batch_id UUID REFERENCES job_batches(id);
+CREATE INDEX IF NOT EXISTS idx_batch_id ON scheduled_provisions(batch_id) WHERE batch_id IS NOT NULL;
+
+CREATE OR REPLACE VIEW dead_letter_jobs AS
+SELECT sp.id, sp.job_type, sp.payload, sp.tags, sp.target_user_email, sp.requested_by,
+       sp.schedule_time, sp.executed_at AS failed_at, sp.retry_count,
+       sp.failure_reason, sp.error_message, sp.plan_id, sp.recurring_job_id, sp.batch_id
+FROM scheduled_provisions sp
+WHERE sp.status = 'failed'
+  AND NOT EXISTS (SELECT 1 FROM scheduled_provisions r WHERE r.replayed_from = sp.id);
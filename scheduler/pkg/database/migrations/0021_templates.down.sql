@@ -0,0 +1,5 @@
+-- Versioned job templates (revert)
+
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS template_version;
+ALTER TABLE scheduled_provisions DROP COLUMN IF EXISTS template_name;
+DROP TABLE IF EXISTS job_templates;
@@ -0,0 +1,16 @@
+-- Versioned job templates
+
+CREATE TABLE IF NOT EXISTS job_templates (
+	name VARCHAR(100) NOT NULL,
+	version INTEGER NOT NULL,
+	job_type VARCHAR(50) NOT NULL,
+	description TEXT,
+	payload JSONB NOT NULL,
+	parameters JSONB NOT NULL DEFAULT '[]',
+	created_by VARCHAR(255),
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (name, version)
+);
+
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS template_name VARCHAR(100);
+ALTER TABLE scheduled_provisions ADD COLUMN IF NOT EXISTS template_version INTEGER;
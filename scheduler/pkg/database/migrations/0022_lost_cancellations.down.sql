@@ -0,0 +1,4 @@
+-- Cancel jobs whose cancellation request was lost (revert)
+--
+-- The up migration only fixed data and changed no schema. The jobs it
+-- cancelled stay cancelled.
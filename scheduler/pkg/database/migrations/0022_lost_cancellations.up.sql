@@ -0,0 +1,7 @@
+-- Cancel jobs whose cancellation request was lost when their worker
+-- released them back to pending or to await a callback
+
+UPDATE scheduled_provisions
+SET status = 'cancelled', cancelled_at = COALESCE(cancelled_at, NOW()),
+    callback_token = NULL, callback_deadline = NULL, updated_at = NOW()
+WHERE status IN ('pending', 'awaiting_callback') AND cancel_requested_at IS NOT NULL;
@@ -0,0 +1,6 @@
+-- Execution attempts of change requests (revert)
+
+DELETE FROM job_attempts WHERE change_request_id IS NOT NULL;
+ALTER TABLE job_attempts DROP CONSTRAINT IF EXISTS attempt_owner;
+ALTER TABLE job_attempts DROP COLUMN IF EXISTS change_request_id;
+ALTER TABLE job_attempts ALTER COLUMN job_id SET NOT NULL;
@@ -0,0 +1,8 @@
+-- Execution attempts of change requests
+
+ALTER TABLE job_attempts ALTER COLUMN job_id DROP NOT NULL;
+ALTER TABLE job_attempts ADD COLUMN IF NOT EXISTS change_request_id UUID REFERENCES change_requests(id) ON DELETE CASCADE;
+ALTER TABLE job_attempts DROP CONSTRAINT IF EXISTS attempt_owner;
+ALTER TABLE job_attempts ADD CONSTRAINT attempt_owner CHECK ((job_id IS NULL) <> (change_request_id IS NULL));
+CREATE INDEX IF NOT EXISTS idx_job_attempts_change_request
+	ON job_attempts(change_request_id, started_at) WHERE change_request_id IS NOT NULL;
@@ -91,23 +91,261 @@ func (j *JSONB) UnmarshalJSON(data []byte) error {
 
 // ScheduledJob is the generic job record for all lifecycle operations.
 type ScheduledJob struct {
+	ID                uuid.UUID      `json:"id"`
+	JobType           string         `json:"job_type"`
+	Payload           JSONB          `json:"payload"`
+	ScheduleTime      time.Time      `json:"schedule_time"`
+	Status            string         `json:"status"`
+	Tags              pq.StringArray `json:"tags"`
+	TargetUserEmail   *string        `json:"target_user_email,omitempty"`
+	RequestedBy       *string        `json:"requested_by,omitempty"`
+	ApprovedBy        *string        `json:"approved_by,omitempty"`
+	ApprovalStatus    string         `json:"approval_status"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	ExecutedAt        *time.Time     `json:"executed_at,omitempty"`
+	ErrorMessage      *string        `json:"error_message,omitempty"`
+	RetryCount        int            `json:"retry_count"`
+	ClaimedBy         *string        `json:"claimed_by,omitempty"`
+	LeaseExpiresAt    *time.Time     `json:"lease_expires_at,omitempty"`
+	NextAttemptAt     *time.Time     `json:"next_attempt_at,omitempty"`
+	DeferredReason    *string        `json:"deferred_reason,omitempty"`
+	IdempotencyKey    *string        `json:"idempotency_key,omitempty"`
+	RequestHash       *string        `json:"-"`
+	CallbackToken     *string        `json:"-"`
+	CallbackDeadline  *time.Time     `json:"callback_deadline,omitempty"`
+	CallbackResult    JSONB          `json:"callback_result,omitempty"`
+	CancelRequestedAt *time.Time     `json:"cancel_requested_at,omitempty"`
+	CancelledBy       *string        `json:"cancelled_by,omitempty"`
+	CancelledAt       *time.Time     `json:"cancelled_at,omitempty"`
+	DryRun            bool           `json:"dry_run"`
+	PlanID            *uuid.UUID     `json:"plan_id,omitempty"`
+	PlanStep          *string        `json:"plan_step,omitempty"`
+	DependsOn         []uuid.UUID    `json:"depends_on,omitempty"`
+	RecurringJobID    *uuid.UUID     `json:"recurring_job_id,omitempty"`
+	FailureReason     *string        `json:"failure_reason,omitempty"`
+	ReplayedFrom      *uuid.UUID     `json:"replayed_from,omitempty"`
+	ReplayedBy        *string        `json:"replayed_by,omitempty"`
+	ReplayedAs        *uuid.UUID     `json:"replayed_as,omitempty"` // the job that replays this one
+	Priority          int            `json:"priority"`              // higher runs first
+	BatchID           *uuid.UUID     `json:"batch_id,omitempty"`
+	TemplateName      *string        `json:"template,omitempty"` // the template the payload was rendered from
+	TemplateVersion   *int           `json:"template_version,omitempty"`
+}
+
+// Failure reasons recorded when a job becomes failed.
+const (
+	FailureRetriesExhausted = "retries_exhausted"
+	FailureNoExecutor       = "no_executor"
+	FailureCallbackTimeout  = "callback_timeout"
+	FailureLeaseExpired     = "lease_expired"
+)
+
+// DeadLetterFilter narrows ListDeadLetters. Nil fields do not filter.
+type DeadLetterFilter struct {
+	JobType       *string
+	FailureReason *string
+	Tag           *string
+	BatchID       *uuid.UUID
+	FailedAfter   *time.Time
+	FailedBefore  *time.Time
+	Limit         int
+	Offset        int
+}
+
+// ReplayOptions controls how ReplayJob clones a failed job. A nil Payload or
+// ScheduleTime keeps the original payload and runs the replay now.
+type ReplayOptions struct {
+	Payload      JSONB
+	ScheduleTime *time.Time
+	ReplayedBy   string
+}
+
+// RecurringJob is a job definition that repeats on a cron or RRULE schedule.
+// The scheduler materializes a ScheduledJob for each upcoming occurrence.
+type RecurringJob struct {
+	ID                uuid.UUID      `json:"id"`
+	Name              string         `json:"name"`
+	JobType           string         `json:"job_type"`
+	Payload           JSONB          `json:"payload"`
+	Tags              pq.StringArray `json:"tags"`
+	TargetUserEmail   *string        `json:"target_user_email,omitempty"`
+	RequestedBy       *string        `json:"requested_by,omitempty"`
+	Schedule          string         `json:"schedule"` // cron expression or RRULE
+	Timezone          string         `json:"timezone"`
+	StartTime         time.Time      `json:"start_time"`
+	EndTime           *time.Time     `json:"end_time,omitempty"`
+	Paused            bool           `json:"paused"`
+	PausedBy          *string        `json:"paused_by,omitempty"`
+	PausedAt          *time.Time     `json:"paused_at,omitempty"`
+	MaterializedUntil *time.Time     `json:"materialized_until,omitempty"` // latest occurrence created
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+}
+
+// JobPlan groups the jobs of a multi-step lifecycle change, such as an
+// offboarding, so they can be followed and cancelled together.
+type JobPlan struct {
 	ID              uuid.UUID      `json:"id"`
-	JobType         string         `json:"job_type"`
-	Payload         JSONB          `json:"payload"`
-	ScheduleTime    time.Time      `json:"schedule_time"`
-	Status          string         `json:"status"`
-	Tags            pq.StringArray `json:"tags"`
+	Name            string         `json:"name"`
 	TargetUserEmail *string        `json:"target_user_email,omitempty"`
-	RequestedBy     *string        `json:"requested_by,omitempty"`
-	ApprovedBy      *string        `json:"approved_by,omitempty"`
-	ApprovalStatus  string         `json:"approval_status"`
+	StartTime       time.Time      `json:"start_time"`
+	CreatedBy       *string        `json:"created_by,omitempty"`
 	CreatedAt       time.Time      `json:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at"`
-	ExecutedAt      *time.Time     `json:"executed_at,omitempty"`
-	ErrorMessage    *string        `json:"error_message,omitempty"`
-	RetryCount      int            `json:"retry_count"`
+	CancelledAt     *time.Time     `json:"cancelled_at,omitempty"`
+	CancelledBy     *string        `json:"cancelled_by,omitempty"`
+	Status          string         `json:"status"` // derived from the steps
+	Steps           []ScheduledJob `json:"steps"`
+}
+
+// Plan status constants. A plan's status is derived from its steps.
+const (
+	PlanStatusActive    = "active"
+	PlanStatusHeld      = "held" // a step failed; the remaining steps wait
+	PlanStatusCompleted = "completed"
+	PlanStatusCancelled = "cancelled"
+)
+
+// JobBatch groups jobs that were created together from one bulk upload, so
+// their progress can be followed and they can be cancelled or replayed as
+// one unit.
+type JobBatch struct {
+	ID          uuid.UUID      `json:"id"`
+	Name        string         `json:"name"`
+	CreatedBy   *string        `json:"created_by,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	CancelledAt *time.Time     `json:"cancelled_at,omitempty"`
+	CancelledBy *string        `json:"cancelled_by,omitempty"`
+	Status      string         `json:"status"`   // derived from the jobs
+	Total       int            `json:"total"`    // jobs, not counting replayed ones
+	Progress    map[string]int `json:"progress"` // job count by status
+	Jobs        []ScheduledJob `json:"jobs"`
+}
+
+// Batch status constants. A batch's status is derived from its jobs.
+const (
+	BatchStatusActive              = "active"
+	BatchStatusCompleted           = "completed"
+	BatchStatusCompletedWithErrors = "completed_with_errors" // every job finished, some failed
+	BatchStatusCancelled           = "cancelled"
+)
+
+// JobTemplate is a named, versioned payload template for a job type. The
+// payload may contain {{param}} placeholders for the declared parameters.
+// Versions are immutable; saving a template under an existing name creates
+// the next version.
+type JobTemplate struct {
+	Name        string         `json:"name"`
+	Version     int            `json:"version"`
+	JobType     string         `json:"job_type"`
+	Description *string        `json:"description,omitempty"`
+	Payload     JSONB          `json:"payload"`
+	Parameters  TemplateParams `json:"parameters"`
+	CreatedBy   *string        `json:"created_by,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
 }
 
+// TemplateParam declares a typed parameter of a JobTemplate.
+type TemplateParam struct {
+	Name        string        `json:"name"`
+	Type        string        `json:"type"` // see the TemplateParam* constants
+	Required    bool          `json:"required,omitempty"`
+	Default     interface{}   `json:"default,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"` // allowed values
+	Description string        `json:"description,omitempty"`
+}
+
+// Template parameter types.
+const (
+	TemplateParamString  = "string"
+	TemplateParamEmail   = "email"
+	TemplateParamInteger = "integer"
+	TemplateParamNumber  = "number"
+	TemplateParamBoolean = "boolean"
+	TemplateParamArray   = "array"
+	TemplateParamObject  = "object"
+)
+
+// TemplateParams is the parameter list of a JobTemplate, stored as JSONB.
+type TemplateParams []TemplateParam
+
+// Value implements the driver.Valuer interface for TemplateParams
+func (p TemplateParams) Value() (driver.Value, error) {
+	if p == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(p)
+}
+
+// Scan implements the sql.Scanner interface for TemplateParams
+func (p *TemplateParams) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(b, p)
+}
+
+// JobAttempt records one execution attempt of a ScheduledJob, including what
+// the downstream webhook answered.
+type JobAttempt struct {
+	ID              uuid.UUID  `json:"id"`
+	JobID           *uuid.UUID `json:"job_id,omitempty"`            // set for scheduled jobs
+	ChangeRequestID *uuid.UUID `json:"change_request_id,omitempty"` // set for change requests
+	AttemptNumber   int        `json:"attempt_number"`
+	WorkerID        string     `json:"worker_id"`
+	Status          string     `json:"status"`
+	TargetURL       *string    `json:"target_url,omitempty"`
+	HTTPStatus      *int       `json:"http_status,omitempty"`
+	LatencyMs       *int64     `json:"latency_ms,omitempty"`
+	ResponseBody    *string    `json:"response_body,omitempty"`
+	ErrorMessage    *string    `json:"error_message,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+// JobEdit records one PATCH of a pending job. Changes maps each edited field
+// to its previous and new value: {"tags": {"from": [...], "to": [...]}}.
+type JobEdit struct {
+	ID       uuid.UUID `json:"id"`
+	JobID    uuid.UUID `json:"job_id"`
+	EditedBy *string   `json:"edited_by,omitempty"`
+	EditedAt time.Time `json:"edited_at"`
+	Changes  JSONB     `json:"changes"`
+}
+
+// JobUpdate lists the fields to change on a pending job. Nil fields are left
+// as they are.
+type JobUpdate struct {
+	ScheduleTime    *time.Time
+	Tags            *[]string
+	Payload         JSONB
+	TargetUserEmail *string
+	Priority        *int
+	EditedBy        *string
+}
+
+// PauseAll is the pause scope that stops every job type.
+const PauseAll = "*"
+
+// Pause is an active kill switch: while it exists, due jobs in its scope
+// (PauseAll or one job type) are not claimed.
+type Pause struct {
+	Scope    string    `json:"scope"`
+	Reason   string    `json:"reason"`
+	PausedBy string    `json:"paused_by"`
+	PausedAt time.Time `json:"paused_at"`
+}
+
+// JobAttempt status constants
+const (
+	AttemptRunning   = "running"
+	AttemptSucceeded = "succeeded"
+	AttemptFailed    = "failed"
+	AttemptAbandoned = "abandoned"
+	AttemptCancelled = "cancelled"
+)
+
 // ScheduledProvision represents a scheduled user provisioning job
 type ScheduledProvision struct {
 	ID           uuid.UUID        `json:"id"`
@@ -135,10 +373,10 @@ type EmployeeData struct {
 
 // ApplicationsData contains application-specific provisioning data
 type ApplicationsData struct {
-	Google           bool                   `json:"google"`
-	Microsoft        bool                   `json:"microsoft"`
-	GoogleWorkspace  map[string]interface{} `json:"google-workspace,omitempty"`
-	Microsoft365     map[string]interface{} `json:"microsoft-365,omitempty"`
+	Google          bool                   `json:"google"`
+	Microsoft       bool                   `json:"microsoft"`
+	GoogleWorkspace map[string]interface{} `json:"google-workspace,omitempty"`
+	Microsoft365    map[string]interface{} `json:"microsoft-365,omitempty"`
 }
 
 // Value implements the driver.Valuer interface for EmployeeData
@@ -176,6 +414,13 @@ const (
 	StatusCompleted = "completed"
 	StatusFailed    = "failed"
 	StatusCancelled = "cancelled"
+
+	// StatusAwaitingCallback means the target accepted the job and will
+	// report the outcome later via POST /api/callbacks/{token}.
+	StatusAwaitingCallback = "awaiting_callback"
+
+	// StatusCompletedDryRun means a dry run passed; nothing was changed.
+	StatusCompletedDryRun = "completed_dry_run"
 )
 
 // Common tags
@@ -239,6 +484,10 @@ type ChangeRequest struct {
 	RetryCount      int        `json:"retry_count"`
 	CreatedAt       time.Time  `json:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at"`
+	ClaimedBy       *string    `json:"claimed_by,omitempty"`
+	LeaseExpiresAt  *time.Time `json:"lease_expires_at,omitempty"`
+	NextAttemptAt   *time.Time `json:"next_attempt_at,omitempty"`
+	DeferredReason  *string    `json:"deferred_reason,omitempty"`
 }
 
 // ChangeRequest status constants
@@ -264,3 +513,16 @@ const (
 	CRTypeSuspend       = "suspend"
 	CRTypeReactivate    = "reactivate"
 )
+
+// ChangeRequestJobTypes maps each ChangeRequest type to the job type whose
+// executor carries it out.
+var ChangeRequestJobTypes = map[string]string{
+	CRTypeProvision:     JobTypeProvision,
+	CRTypeTerminate:     JobTypeTerminate,
+	CRTypeGroupChange:   JobTypeModifyGroups,
+	CRTypeLicenseChange: JobTypeModifyLicense,
+	CRTypePasswordReset: JobTypePasswordReset,
+	CRTypeRoleChange:    JobTypeModifyRole,
+	CRTypeSuspend:       JobTypeSuspend,
+	CRTypeReactivate:    JobTypeReactivate,
+}
@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/database"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxResponseBodyBytes is how much of a webhook response is kept on the
+// job attempt record.
+const maxResponseBodyBytes = 8 * 1024
+
+// readBody reads at most maxResponseBodyBytes from r and returns it as text
+// safe to store in Postgres, or nil if it is empty.
+func readBody(r io.Reader) *string {
+	data, err := io.ReadAll(io.LimitReader(r, maxResponseBodyBytes+1))
+	if err != nil && len(data) == 0 {
+		return nil
+	}
+	return truncateBody(data)
+}
+
+// truncateBody cuts data to maxResponseBodyBytes and strips bytes Postgres
+// will not store in a TEXT column.
+func truncateBody(data []byte) *string {
+	truncated := len(data) > maxResponseBodyBytes
+	if truncated {
+		data = data[:maxResponseBodyBytes]
+	}
+
+	body := strings.ToValidUTF8(string(data), "\uFFFD")
+	body = strings.ReplaceAll(body, "\x00", "")
+	if body == "" {
+		return nil
+	}
+	if truncated {
+		body += "\n...[truncated]"
+	}
+	return &body
+}
+
+// finishAttempt records the outcome of an attempt from the executor's result
+// and error. A nil attempt (one that could not be recorded at the start) is
+// ignored.
+func (s *Scheduler) finishAttempt(attempt *database.JobAttempt, result *Result, latency time.Duration, execErr error) {
+	if attempt == nil {
+		return
+	}
+
+	attempt.Status = database.AttemptSucceeded
+	if execErr != nil {
+		errMsg := execErr.Error()
+		attempt.Status = database.AttemptFailed
+		if errors.Is(execErr, errJobCancelled) {
+			attempt.Status = database.AttemptCancelled
+		}
+		attempt.ErrorMessage = &errMsg
+	}
+	if result != nil {
+		if result.Target != "" {
+			target := result.Target
+			attempt.TargetURL = &target
+		}
+		if result.StatusCode != 0 {
+			code := result.StatusCode
+			attempt.HTTPStatus = &code
+		}
+		attempt.ResponseBody = result.Body
+	}
+	if latency > 0 {
+		ms := latency.Milliseconds()
+		attempt.LatencyMs = &ms
+	}
+
+	if err := s.db.FinishJobAttempt(attempt); err != nil {
+		log.WithField("attempt_id", attempt.ID).Errorf("Failed to record attempt outcome: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/config"
+)
+
+// retryDelay returns how long to wait before retry number attempt (1-based).
+// The delay grows by policy.Multiplier per attempt, is capped at
+// policy.MaxDelay, and is spread by +/- policy.Jitter so jobs that failed
+// together do not all retry at the same instant.
+func retryDelay(policy config.RetryPolicy, attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	base := float64(policy.Delay) * float64(time.Second)
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := base * math.Pow(multiplier, float64(attempt-1))
+
+	maxDelay := float64(policy.MaxDelay) * float64(time.Second)
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+
+	if policy.Jitter > 0 {
+		delay *= 1 + policy.Jitter*(2*rand.Float64()-1)
+		if maxDelay > 0 && delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
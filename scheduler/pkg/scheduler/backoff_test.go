@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/config"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  config.RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{name: "no delay", policy: config.RetryPolicy{}, attempt: 1, want: 0},
+		{name: "fixed delay", policy: config.RetryPolicy{Delay: 30}, attempt: 4, want: 30 * time.Second},
+		{name: "multiplier below one is ignored", policy: config.RetryPolicy{Delay: 30, Multiplier: 0.5}, attempt: 3, want: 30 * time.Second},
+		{name: "first retry", policy: config.RetryPolicy{Delay: 60, Multiplier: 2}, attempt: 1, want: time.Minute},
+		{name: "third retry", policy: config.RetryPolicy{Delay: 60, Multiplier: 2}, attempt: 3, want: 4 * time.Minute},
+		{name: "attempt below one counts as the first", policy: config.RetryPolicy{Delay: 60, Multiplier: 2}, attempt: 0, want: time.Minute},
+		{name: "capped", policy: config.RetryPolicy{Delay: 60, Multiplier: 2, MaxDelay: 300}, attempt: 10, want: 5 * time.Minute},
+		{name: "zero cap means uncapped", policy: config.RetryPolicy{Delay: 60, Multiplier: 2, MaxDelay: 0}, attempt: 6, want: 32 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryDelay(tt.policy, tt.attempt); got != tt.want {
+				t.Errorf("retryDelay(%+v, %d) = %s, want %s", tt.policy, tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelayJitterBounds(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   config.RetryPolicy
+		attempt  int
+		min, max time.Duration
+	}{
+		{
+			name:    "spread around the delay",
+			policy:  config.RetryPolicy{Delay: 100, Multiplier: 2, Jitter: 0.2},
+			attempt: 2,
+			min:     160 * time.Second,
+			max:     240 * time.Second,
+		},
+		{
+			name:    "never above the cap",
+			policy:  config.RetryPolicy{Delay: 100, Multiplier: 2, MaxDelay: 150, Jitter: 0.5},
+			attempt: 3,
+			min:     75 * time.Second,
+			max:     150 * time.Second,
+		},
+		{
+			name:    "full jitter never goes negative",
+			policy:  config.RetryPolicy{Delay: 10, Jitter: 1},
+			attempt: 1,
+			min:     0,
+			max:     20 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distinct := map[time.Duration]bool{}
+			for i := 0; i < 1000; i++ {
+				got := retryDelay(tt.policy, tt.attempt)
+				if got < tt.min || got > tt.max {
+					t.Fatalf("retryDelay() = %s, want between %s and %s", got, tt.min, tt.max)
+				}
+				distinct[got] = true
+			}
+			if len(distinct) < 2 {
+				t.Errorf("retryDelay() returned the same delay 1000 times; jitter is not applied")
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package scheduler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/config"
+)
+
+// maxCalendarSteps bounds the search for the next open time, so a calendar
+// that is never open cannot loop forever.
+const maxCalendarSteps = 1000
+
+// Calendar decides when job types may execute, combining weekly execution
+// windows with blackout periods.
+type Calendar struct {
+	loc       *time.Location
+	windows   map[string]window
+	blackouts []blackout
+}
+
+// window is a parsed ExecutionWindow; start and end are minutes after
+// midnight local time, end exclusive.
+type window struct {
+	days  [7]bool
+	start int
+	end   int
+}
+
+// blackout is a closed period; jobTypes is nil when it applies to all types.
+type blackout struct {
+	name     string
+	start    time.Time
+	end      time.Time
+	jobTypes map[string]bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// NewCalendar builds a Calendar from config, loading any holiday calendars
+// from disk. Times are interpreted in loc.
+func NewCalendar(cfg config.CalendarConfig, loc *time.Location) (*Calendar, error) {
+	c := &Calendar{loc: loc, windows: map[string]window{}}
+
+	for jobType, w := range cfg.Windows {
+		parsed, err := parseWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("calendar window for %s: %w", jobType, err)
+		}
+		c.windows[jobType] = parsed
+	}
+
+	for _, b := range cfg.Blackouts {
+		start, _, err := parseCalendarTime(b.Start, loc)
+		if err != nil {
+			return nil, fmt.Errorf("blackout %q start: %w", b.Name, err)
+		}
+		end, dateOnly, err := parseCalendarTime(b.End, loc)
+		if err != nil {
+			return nil, fmt.Errorf("blackout %q end: %w", b.Name, err)
+		}
+		if dateOnly {
+			end = end.AddDate(0, 0, 1)
+		}
+		if !end.After(start) {
+			return nil, fmt.Errorf("blackout %q ends before it starts", b.Name)
+		}
+		c.blackouts = append(c.blackouts, blackout{
+			name:     b.Name,
+			start:    start,
+			end:      end,
+			jobTypes: jobTypeSet(b.JobTypes),
+		})
+	}
+
+	for _, hc := range cfg.HolidayCalendars {
+		events, err := loadICS(hc.Path, loc)
+		if err != nil {
+			return nil, fmt.Errorf("holiday calendar %s: %w", hc.Path, err)
+		}
+		for _, event := range events {
+			event.jobTypes = jobTypeSet(hc.JobTypes)
+			c.blackouts = append(c.blackouts, event)
+		}
+	}
+
+	return c, nil
+}
+
+// NextOpen returns the earliest time at or after t when jobType may run,
+// together with the reason it cannot run at t. If the job may run at t, it
+// returns t and an empty reason.
+func (c *Calendar) NextOpen(jobType string, t time.Time) (time.Time, string) {
+	if c == nil {
+		return t, ""
+	}
+
+	candidate := t
+	reason := ""
+	for step := 0; step < maxCalendarSteps; step++ {
+		moved := false
+
+		for _, b := range c.blackouts {
+			if b.applies(jobType) && !candidate.Before(b.start) && candidate.Before(b.end) {
+				if reason == "" {
+					reason = fmt.Sprintf("blackout %q", b.name)
+				}
+				candidate = b.end
+				moved = true
+			}
+		}
+
+		if w, ok := c.windows[jobType]; ok {
+			if next := w.next(candidate.In(c.loc)); !next.Equal(candidate) {
+				if reason == "" {
+					reason = fmt.Sprintf("outside %s execution window", jobType)
+				}
+				candidate = next
+				moved = true
+			}
+		}
+
+		if !moved {
+			break
+		}
+	}
+
+	return candidate, reason
+}
+
+func (b blackout) applies(jobType string) bool {
+	return b.jobTypes == nil || b.jobTypes[jobType]
+}
+
+// next returns t if it falls inside the window, otherwise the start of the
+// next window occurrence.
+func (w window) next(t time.Time) time.Time {
+	minutes := t.Hour()*60 + t.Minute()
+	if w.days[t.Weekday()] && minutes >= w.start && minutes < w.end {
+		return t
+	}
+
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for i := 0; i <= 7; i++ {
+		d := day.AddDate(0, 0, i)
+		if !w.days[d.Weekday()] {
+			continue
+		}
+		// Built from the wall clock, not as an offset from midnight, so a
+		// 09:00 window opens at 09:00 on DST transition days too.
+		start := time.Date(d.Year(), d.Month(), d.Day(), w.start/60, w.start%60, 0, 0, t.Location())
+		if start.After(t) {
+			return start
+		}
+	}
+	return t
+}
+
+func parseWindow(w config.ExecutionWindow) (window, error) {
+	var parsed window
+
+	if len(w.Days) == 0 {
+		for i := range parsed.days {
+			parsed.days[i] = true
+		}
+	}
+	for _, day := range w.Days {
+		key := strings.ToLower(strings.TrimSpace(day))
+		if len(key) > 3 {
+			key = key[:3]
+		}
+		wd, ok := weekdays[key]
+		if !ok {
+			return window{}, fmt.Errorf("unknown day %q", day)
+		}
+		parsed.days[wd] = true
+	}
+
+	start, err := parseClock(w.Start, 0)
+	if err != nil {
+		return window{}, fmt.Errorf("start: %w", err)
+	}
+	end, err := parseClock(w.End, 24*60)
+	if err != nil {
+		return window{}, fmt.Errorf("end: %w", err)
+	}
+	if end <= start {
+		return window{}, fmt.Errorf("end must be after start")
+	}
+	parsed.start, parsed.end = start, end
+	return parsed, nil
+}
+
+// parseClock parses HH:MM into minutes after midnight; empty returns def.
+func parseClock(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseCalendarTime parses a date or date-time in loc, reporting whether the
+// value was a bare date.
+func parseCalendarTime(value string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, true, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, false, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("expected 2006-01-02 or 2006-01-02 15:04, got %q", value)
+}
+
+// loadICS reads VEVENT entries from an iCalendar file as blackouts. All-day
+// events block whole days in loc. Recurrence rules are not expanded, so
+// holiday files should list each occurrence.
+func loadICS(path string, loc *time.Location) ([]blackout, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Unfold continuation lines (RFC 5545 section 3.1).
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var events []blackout
+	var inEvent, allDay bool
+	var event blackout
+	for _, line := range lines {
+		name, params, value := splitICSLine(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			inEvent, allDay = true, false
+			event = blackout{}
+		case name == "END" && value == "VEVENT":
+			inEvent = false
+			if event.start.IsZero() {
+				continue
+			}
+			if event.end.IsZero() || !event.end.After(event.start) {
+				if allDay {
+					event.end = event.start.AddDate(0, 0, 1)
+				} else {
+					continue
+				}
+			}
+			if event.name == "" {
+				event.name = "holiday"
+			}
+			events = append(events, event)
+		case !inEvent:
+			continue
+		case name == "SUMMARY":
+			event.name = strings.ReplaceAll(value, `\,`, ",")
+		case name == "DTSTART" || name == "DTEND":
+			t, dateOnly, err := parseICSTime(value, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if name == "DTSTART" {
+				event.start, allDay = t, dateOnly
+			} else {
+				event.end = t
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// splitICSLine splits "NAME;PARAM=x:VALUE" into its parts.
+func splitICSLine(line string) (string, map[string]string, string) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return line, nil, ""
+	}
+	head, value := line[:colon], line[colon+1:]
+	parts := strings.Split(head, ";")
+	params := map[string]string{}
+	for _, p := range parts[1:] {
+		if eq := strings.Index(p, "="); eq >= 0 {
+			params[strings.ToUpper(p[:eq])] = p[eq+1:]
+		}
+	}
+	return strings.ToUpper(parts[0]), params, value
+}
+
+func parseICSTime(value string, params map[string]string, loc *time.Location) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	if tzid := params["TZID"]; tzid != "" {
+		if tzLoc, err := time.LoadLocation(tzid); err == nil {
+			loc = tzLoc
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+func jobTypeSet(jobTypes []string) map[string]bool {
+	if len(jobTypes) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(jobTypes))
+	for _, jt := range jobTypes {
+		set[jt] = true
+	}
+	return set
+}
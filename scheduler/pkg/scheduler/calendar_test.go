@@ -0,0 +1,384 @@
+package scheduler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/config"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+	return loc
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		name      string
+		window    config.ExecutionWindow
+		wantDays  []time.Weekday
+		wantStart int
+		wantEnd   int
+		wantErr   bool
+	}{
+		{
+			name:      "defaults to every day, all day",
+			window:    config.ExecutionWindow{},
+			wantDays:  []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday},
+			wantStart: 0,
+			wantEnd:   24 * 60,
+		},
+		{
+			name:      "full and abbreviated day names",
+			window:    config.ExecutionWindow{Days: []string{"Monday", " wed ", "FRI"}, Start: "09:00", End: "17:30"},
+			wantDays:  []time.Weekday{time.Monday, time.Wednesday, time.Friday},
+			wantStart: 9 * 60,
+			wantEnd:   17*60 + 30,
+		},
+		{
+			name:      "end of day",
+			window:    config.ExecutionWindow{Days: []string{"sat"}, Start: "22:00", End: "24:00"},
+			wantDays:  []time.Weekday{time.Saturday},
+			wantStart: 22 * 60,
+			wantEnd:   24 * 60,
+		},
+		{name: "unknown day", window: config.ExecutionWindow{Days: []string{"funday"}}, wantErr: true},
+		{name: "bad start", window: config.ExecutionWindow{Start: "9am"}, wantErr: true},
+		{name: "bad end", window: config.ExecutionWindow{End: "25:00"}, wantErr: true},
+		{name: "end before start", window: config.ExecutionWindow{Start: "17:00", End: "09:00"}, wantErr: true},
+		{name: "empty window", window: config.ExecutionWindow{Start: "09:00", End: "09:00"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseWindow(tt.window)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseWindow() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseWindow() error: %v", err)
+			}
+
+			var wantDays [7]bool
+			for _, d := range tt.wantDays {
+				wantDays[d] = true
+			}
+			if got.days != wantDays {
+				t.Errorf("days = %v, want %v", got.days, wantDays)
+			}
+			if got.start != tt.wantStart || got.end != tt.wantEnd {
+				t.Errorf("start, end = %d, %d, want %d, %d", got.start, got.end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestWindowNext(t *testing.T) {
+	ny := mustLoadLocation(t, "America/New_York")
+	weekdays, err := parseWindow(config.ExecutionWindow{
+		Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	everyDay, err := parseWindow(config.ExecutionWindow{Start: "09:00", End: "17:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		window window
+		at     time.Time
+		want   time.Time
+	}{
+		{
+			name:   "inside the window",
+			window: weekdays,
+			at:     time.Date(2026, 10, 14, 12, 0, 0, 0, ny),
+			want:   time.Date(2026, 10, 14, 12, 0, 0, 0, ny),
+		},
+		{
+			name:   "before the window opens",
+			window: weekdays,
+			at:     time.Date(2026, 10, 14, 7, 30, 0, 0, ny),
+			want:   time.Date(2026, 10, 14, 9, 0, 0, 0, ny),
+		},
+		{
+			name:   "end is exclusive",
+			window: weekdays,
+			at:     time.Date(2026, 10, 14, 17, 0, 0, 0, ny),
+			want:   time.Date(2026, 10, 15, 9, 0, 0, 0, ny),
+		},
+		{
+			name:   "friday evening skips the weekend",
+			window: weekdays,
+			at:     time.Date(2026, 10, 16, 18, 0, 0, 0, ny),
+			want:   time.Date(2026, 10, 19, 9, 0, 0, 0, ny),
+		},
+		{
+			name:   "spring forward day",
+			window: everyDay,
+			at:     time.Date(2026, 3, 8, 5, 0, 0, 0, ny),
+			want:   time.Date(2026, 3, 8, 9, 0, 0, 0, ny),
+		},
+		{
+			name:   "fall back day",
+			window: everyDay,
+			at:     time.Date(2026, 11, 1, 5, 0, 0, 0, ny),
+			want:   time.Date(2026, 11, 1, 9, 0, 0, 0, ny),
+		},
+		{
+			name:   "day after spring forward",
+			window: everyDay,
+			at:     time.Date(2026, 3, 8, 18, 0, 0, 0, ny),
+			want:   time.Date(2026, 3, 9, 9, 0, 0, 0, ny),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.window.next(tt.at)
+			if !got.Equal(tt.want) {
+				t.Errorf("next(%s) = %s, want %s", tt.at, got, tt.want)
+			}
+			if got.Hour() != tt.want.Hour() || got.Minute() != tt.want.Minute() {
+				t.Errorf("next(%s) wall clock = %s, want %s", tt.at, got.Format("15:04"), tt.want.Format("15:04"))
+			}
+		})
+	}
+}
+
+func TestCalendarNextOpen(t *testing.T) {
+	ny := mustLoadLocation(t, "America/New_York")
+	cal, err := NewCalendar(config.CalendarConfig{
+		Windows: map[string]config.ExecutionWindow{
+			"terminate": {Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"},
+		},
+		Blackouts: []config.BlackoutConfig{
+			{Name: "freeze", Start: "2026-12-24", End: "2026-12-26", JobTypes: []string{"terminate"}},
+			{Name: "maintenance", Start: "2026-10-14 10:00", End: "2026-10-14 11:00"},
+		},
+	}, ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		jobType    string
+		at         time.Time
+		want       time.Time
+		wantReason string
+	}{
+		{
+			name:    "open",
+			jobType: "terminate",
+			at:      time.Date(2026, 10, 14, 9, 30, 0, 0, ny),
+			want:    time.Date(2026, 10, 14, 9, 30, 0, 0, ny),
+		},
+		{
+			name:       "outside the window",
+			jobType:    "terminate",
+			at:         time.Date(2026, 10, 14, 20, 0, 0, 0, ny),
+			want:       time.Date(2026, 10, 15, 9, 0, 0, 0, ny),
+			wantReason: "outside terminate execution window",
+		},
+		{
+			name:       "blackout for every job type",
+			jobType:    "provision",
+			at:         time.Date(2026, 10, 14, 10, 15, 0, 0, ny),
+			want:       time.Date(2026, 10, 14, 11, 0, 0, 0, ny),
+			wantReason: `blackout "maintenance"`,
+		},
+		{
+			name:       "date-only blackout covers its last day, then waits for the window",
+			jobType:    "terminate",
+			at:         time.Date(2026, 12, 24, 12, 0, 0, 0, ny),
+			want:       time.Date(2026, 12, 28, 9, 0, 0, 0, ny),
+			wantReason: `blackout "freeze"`,
+		},
+		{
+			name:    "blackout limited to other job types",
+			jobType: "provision",
+			at:      time.Date(2026, 12, 24, 12, 0, 0, 0, ny),
+			want:    time.Date(2026, 12, 24, 12, 0, 0, 0, ny),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := cal.NextOpen(tt.jobType, tt.at)
+			if !got.Equal(tt.want) {
+				t.Errorf("NextOpen() = %s, want %s", got, tt.want)
+			}
+			if reason != tt.wantReason {
+				t.Errorf("NextOpen() reason = %q, want %q", reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestParseICSTime(t *testing.T) {
+	ny := mustLoadLocation(t, "America/New_York")
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+
+	tests := []struct {
+		name         string
+		value        string
+		params       map[string]string
+		want         time.Time
+		wantDateOnly bool
+		wantErr      bool
+	}{
+		{
+			name:         "date value",
+			value:        "20261225",
+			params:       map[string]string{"VALUE": "DATE"},
+			want:         time.Date(2026, 12, 25, 0, 0, 0, 0, ny),
+			wantDateOnly: true,
+		},
+		{
+			name:         "bare date",
+			value:        "20261225",
+			want:         time.Date(2026, 12, 25, 0, 0, 0, 0, ny),
+			wantDateOnly: true,
+		},
+		{
+			name:  "UTC",
+			value: "20261225T150000Z",
+			want:  time.Date(2026, 12, 25, 15, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "TZID",
+			value:  "20261225T090000",
+			params: map[string]string{"TZID": "Europe/Berlin"},
+			want:   time.Date(2026, 12, 25, 9, 0, 0, 0, berlin),
+		},
+		{
+			name:   "unknown TZID falls back to the calendar timezone",
+			value:  "20261225T090000",
+			params: map[string]string{"TZID": "Mars/Olympus"},
+			want:   time.Date(2026, 12, 25, 9, 0, 0, 0, ny),
+		},
+		{
+			name:  "floating time",
+			value: "20261225T090000",
+			want:  time.Date(2026, 12, 25, 9, 0, 0, 0, ny),
+		},
+		{name: "invalid", value: "tomorrow", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, dateOnly, err := parseICSTime(tt.value, tt.params, ny)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseICSTime() = %s, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseICSTime() error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseICSTime() = %s, want %s", got, tt.want)
+			}
+			if dateOnly != tt.wantDateOnly {
+				t.Errorf("dateOnly = %v, want %v", dateOnly, tt.wantDateOnly)
+			}
+		})
+	}
+}
+
+func TestLoadICS(t *testing.T) {
+	ny := mustLoadLocation(t, "America/New_York")
+
+	ics := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"DTSTART;VALUE=DATE:20261225\r\n" +
+		"SUMMARY:Christmas Day\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"DTSTART;VALUE=DATE:20261231\r\n" +
+		"DTEND;VALUE=DATE:20270102\r\n" +
+		"SUMMARY:New Year\\, observed and\r\n" +
+		"  folded\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"DTSTART;TZID=Europe/Berlin:20261120T090000\r\n" +
+		"DTEND;TZID=Europe/Berlin:20261120T120000\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"DTSTART:20261121T090000Z\r\n" +
+		"SUMMARY:Timed event without an end is skipped\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"SUMMARY:No start is skipped\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	path := filepath.Join(t.TempDir(), "holidays.ics")
+	if err := os.WriteFile(path, []byte(ics), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := loadICS(path, ny)
+	if err != nil {
+		t.Fatalf("loadICS() error: %v", err)
+	}
+
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	want := []blackout{
+		{
+			name:  "Christmas Day",
+			start: time.Date(2026, 12, 25, 0, 0, 0, 0, ny),
+			end:   time.Date(2026, 12, 26, 0, 0, 0, 0, ny),
+		},
+		{
+			name:  "New Year, observed and folded",
+			start: time.Date(2026, 12, 31, 0, 0, 0, 0, ny),
+			end:   time.Date(2027, 1, 2, 0, 0, 0, 0, ny),
+		},
+		{
+			name:  "holiday",
+			start: time.Date(2026, 11, 20, 9, 0, 0, 0, berlin),
+			end:   time.Date(2026, 11, 20, 12, 0, 0, 0, berlin),
+		},
+	}
+
+	if len(events) != len(want) {
+		t.Fatalf("loadICS() returned %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, event := range events {
+		if event.name != want[i].name {
+			t.Errorf("event %d name = %q, want %q", i, event.name, want[i].name)
+		}
+		if !event.start.Equal(want[i].start) || !event.end.Equal(want[i].end) {
+			t.Errorf("event %d = %s to %s, want %s to %s", i, event.start, event.end, want[i].start, want[i].end)
+		}
+	}
+}
+
+func TestLoadICSInvalidTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.ics")
+	ics := "BEGIN:VEVENT\nDTSTART:not-a-date\nEND:VEVENT\n"
+	if err := os.WriteFile(path, []byte(ics), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadICS(path, time.UTC); err == nil {
+		t.Fatal("loadICS() succeeded, want error")
+	}
+}
@@ -0,0 +1,157 @@
+package scheduler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/database"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultCallbackTimeout is used when scheduler.callback_timeout is not set.
+const defaultCallbackTimeout = time.Hour
+
+// ErrCallbackNotFound is returned when no job is waiting on a callback token,
+// either because the token is unknown or the job was already resolved.
+var ErrCallbackNotFound = errors.New("no job is awaiting this callback")
+
+// ErrInvalidCallback is returned for a callback with an unrecognised status.
+var ErrInvalidCallback = errors.New("invalid callback")
+
+// Callback is the outcome a target reports for a job it accepted with 202.
+type Callback struct {
+	Status  string          `json:"status"` // completed or failed
+	Error   string          `json:"error,omitempty"`
+	Results json.RawMessage `json:"results,omitempty"` // e.g. per-app outcomes, stored as sent
+}
+
+// newCallbackToken returns an unguessable token identifying one attempt.
+func newCallbackToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// callbackURL is the endpoint a target should report to for token, or empty
+// if scheduler.callback_url is not configured.
+func (s *Scheduler) callbackURL(token string) string {
+	base := strings.TrimRight(s.cfg.Scheduler.CallbackURL, "/")
+	if base == "" || token == "" {
+		return ""
+	}
+	return base + "/api/callbacks/" + url.PathEscape(token)
+}
+
+// callbackTimeout is how long an accepted job may wait for its callback.
+func (s *Scheduler) callbackTimeout() time.Duration {
+	if s.cfg.Scheduler.CallbackTimeout > 0 {
+		return time.Duration(s.cfg.Scheduler.CallbackTimeout) * time.Second
+	}
+	return defaultCallbackTimeout
+}
+
+// awaitCallback parks a claimed job until its target calls back.
+func (s *Scheduler) awaitCallback(job database.ScheduledJob, token string) {
+	logger := log.WithField("id", job.ID)
+
+	deadline := time.Now().Add(s.callbackTimeout())
+	err := s.db.AwaitJobCallback(job.ID, s.workerID, token, deadline)
+	if errors.Is(err, database.ErrCancelRequested) {
+		s.finishCancelRequested(job, true)
+	} else if errors.Is(err, database.ErrJobNotClaimed) {
+		logger.Warn("Lost claim on job before awaiting its callback")
+	} else if err != nil {
+		logger.Errorf("Failed to record callback token: %v", err)
+	}
+}
+
+// HandleCallback applies the outcome reported for the job waiting on token.
+// A failed outcome goes through the job type's retry policy like any other
+// failed attempt. It returns ErrCallbackNotFound if no job is waiting.
+func (s *Scheduler) HandleCallback(token string, cb Callback) (*database.ScheduledJob, error) {
+	var succeeded bool
+	switch strings.ToLower(cb.Status) {
+	case "completed", "succeeded", "success":
+		succeeded = true
+	case "failed", "failure", "error":
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidCallback, cb.Status)
+	}
+
+	job, err := s.db.GetJobByCallbackToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrCallbackNotFound
+	}
+
+	errorMsg := cb.Error
+	if !succeeded && errorMsg == "" {
+		errorMsg = "target reported failure"
+	}
+
+	resolved, err := s.resolveCallback(*job, succeeded, errorMsg, database.JSONB(cb.Results))
+	if err != nil {
+		return nil, err
+	}
+	if !resolved {
+		return nil, ErrCallbackNotFound
+	}
+
+	return s.db.GetJobByID(job.ID)
+}
+
+// timeOutCallbacks fails jobs whose callback did not arrive in time. They
+// are not retried: the target accepted the job and may still be running it,
+// so sending it again could run it twice. A job can be replayed instead.
+func (s *Scheduler) timeOutCallbacks() {
+	jobs, err := s.db.GetExpiredCallbacks()
+	if err != nil {
+		log.Errorf("Failed to query expired callbacks: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		reason := "no callback received before the deadline"
+		if job.CallbackDeadline != nil {
+			reason = fmt.Sprintf("no callback received by %s", job.CallbackDeadline.In(s.location).Format(time.RFC3339))
+		}
+
+		resolved, err := s.db.ResolveJobCallback(job, database.StatusFailed, &reason, nil, nil, database.FailureCallbackTimeout)
+		if err != nil {
+			log.WithField("id", job.ID).Errorf("Failed to time out callback: %v", err)
+			continue
+		}
+		if resolved {
+			log.WithField("id", job.ID).Warn("Job callback timed out")
+		}
+	}
+}
+
+// resolveCallback moves a job out of awaiting_callback: completed, pending
+// for a retry with backoff, or failed once retries are used up.
+func (s *Scheduler) resolveCallback(job database.ScheduledJob, succeeded bool, errorMsg string, results database.JSONB) (bool, error) {
+	if succeeded {
+		return s.db.ResolveJobCallback(job, database.StatusCompleted, nil, results, nil, "")
+	}
+
+	policy := s.cfg.Scheduler.RetryPolicyFor(job.JobType)
+	status := database.StatusFailed
+	var nextAttempt *time.Time
+	if job.RetryCount < policy.MaxRetries {
+		status = database.StatusPending
+		next := time.Now().Add(retryDelay(policy, job.RetryCount+1))
+		nextAttempt = &next
+	}
+
+	return s.db.ResolveJobCallback(job, status, &errorMsg, results, nextAttempt, database.FailureRetriesExhausted)
+}
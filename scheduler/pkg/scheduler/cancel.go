@@ -0,0 +1,285 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/database"
+	log "github.com/sirupsen/logrus"
+)
+
+// compensationTimeout bounds a single Compensate call.
+const compensationTimeout = 2 * time.Minute
+
+// errJobCancelled is the cancellation cause of an execution's context when
+// someone cancelled the job.
+var errJobCancelled = errors.New("job cancelled")
+
+// ErrNoCompensation is returned by a Compensator that has nothing to undo
+// for the execution, e.g. because no compensating endpoint is configured.
+var ErrNoCompensation = errors.New("no compensation configured")
+
+// Cancellation describes a cancelled execution handed to a Compensator.
+type Cancellation struct {
+	CancelledBy string
+	// Result is what the target answered before the execution was
+	// aborted, if anything. It is nil if the request never completed or the
+	// job was waiting on a callback.
+	Result *Result
+}
+
+// Compensator is implemented by executors that can undo or clean up after an
+// execution that was cancelled part-way.
+type Compensator interface {
+	Compensate(ctx context.Context, run Execution, cancellation Cancellation) error
+}
+
+// CancelJob cancels a job on behalf of cancelledBy and returns the status it
+// was in. A pending job is cancelled outright. An executing job has its
+// context cancelled: at once if it runs in this process, otherwise by its
+// own worker on notification or at its next heartbeat. A job waiting on a
+// callback is cancelled and its executor asked to compensate.
+func (s *Scheduler) CancelJob(id uuid.UUID, cancelledBy string) (string, error) {
+	previous, err := s.db.CancelJob(id, cancelledBy)
+	if err != nil {
+		return "", err
+	}
+
+	switch previous {
+	case database.StatusExecuting:
+		s.cancelRunning(id)
+	case database.StatusAwaitingCallback:
+		go s.compensateAwaitingCallback(id, cancelledBy)
+	}
+	return previous, nil
+}
+
+// CancelPlan cancels a plan on behalf of cancelledBy. Every step that has
+// not finished is cancelled as with CancelJob. It returns the plan as it
+// stands afterwards, or nil if the plan does not exist.
+func (s *Scheduler) CancelPlan(id uuid.UUID, cancelledBy string) (*database.JobPlan, error) {
+	found, err := s.db.MarkPlanCancelled(id, cancelledBy)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+
+	plan, err := s.db.GetPlan(id)
+	if err != nil {
+		return nil, err
+	}
+
+	cancelled, err := s.cancelUnfinished(plan.Steps, cancelledBy)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"plan_id": id,
+		"steps":   cancelled,
+	}).Infof("Cancelled plan on behalf of %s", cancelledBy)
+
+	return s.db.GetPlan(id)
+}
+
+// CancelBatch cancels a batch on behalf of cancelledBy. Every job of the
+// batch that has not finished is cancelled as with CancelJob. It returns the
+// batch as it stands afterwards, or nil if the batch does not exist.
+func (s *Scheduler) CancelBatch(id uuid.UUID, cancelledBy string) (*database.JobBatch, error) {
+	found, err := s.db.MarkBatchCancelled(id, cancelledBy)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+
+	batch, err := s.db.GetBatch(id)
+	if err != nil {
+		return nil, err
+	}
+
+	cancelled, err := s.cancelUnfinished(batch.Jobs, cancelledBy)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"batch_id": id,
+		"jobs":     cancelled,
+	}).Infof("Cancelled batch on behalf of %s", cancelledBy)
+
+	return s.db.GetBatch(id)
+}
+
+// cancelUnfinished cancels every job in jobs that has not finished and
+// returns how many were cancelled.
+func (s *Scheduler) cancelUnfinished(jobs []database.ScheduledJob, cancelledBy string) (int, error) {
+	cancelled := 0
+	for _, job := range jobs {
+		switch job.Status {
+		case database.StatusPending, database.StatusExecuting, database.StatusAwaitingCallback:
+		default:
+			continue
+		}
+		_, err := s.CancelJob(job.ID, cancelledBy)
+		if errors.Is(err, database.ErrJobNotCancellable) {
+			// Finished while we were cancelling.
+			continue
+		}
+		if err != nil {
+			return cancelled, fmt.Errorf("failed to cancel job %s: %w", job.ID, err)
+		}
+		cancelled++
+	}
+	return cancelled, nil
+}
+
+// trackRunning registers the cancel function of an execution in this
+// process. The returned function unregisters it.
+func (s *Scheduler) trackRunning(id uuid.UUID, cancel context.CancelCauseFunc) func() {
+	s.runningMu.Lock()
+	s.running[id] = cancel
+	s.runningMu.Unlock()
+
+	return func() {
+		s.runningMu.Lock()
+		delete(s.running, id)
+		s.runningMu.Unlock()
+	}
+}
+
+// cancelRunning aborts the execution of a job if it runs in this process.
+func (s *Scheduler) cancelRunning(id uuid.UUID) {
+	s.abortRunning(id, errJobCancelled)
+}
+
+// abortRunning cancels the context of an execution in this process, if there
+// is one, with the given cause.
+func (s *Scheduler) abortRunning(id uuid.UUID, cause error) {
+	s.runningMu.Lock()
+	cancel, ok := s.running[id]
+	s.runningMu.Unlock()
+
+	if ok {
+		log.WithField("id", id).Infof("Aborting in-flight execution: %v", cause)
+		cancel(cause)
+	}
+}
+
+// finishCancelledExecution records an execution aborted by cancellation,
+// asks the executor to compensate, and marks the job cancelled.
+func (s *Scheduler) finishCancelledExecution(job database.ScheduledJob, executor Executor, run Execution, attempt *database.JobAttempt, result *Result, latency time.Duration) {
+	cancelledBy := s.cancelledBy(job.ID)
+
+	cancelErr := fmt.Errorf("%w by %s", errJobCancelled, cancelledBy)
+	s.finishAttempt(attempt, result, latency, cancelErr)
+
+	errMsg := cancelErr.Error()
+	if outcome := s.compensate(executor, run, Cancellation{CancelledBy: cancelledBy, Result: result}); outcome != "" {
+		errMsg += "; " + outcome
+	}
+	s.finishCancelledJob(job.ID, errMsg)
+}
+
+// finishCancelRequested marks a claimed job cancelled whose cancellation was
+// requested after its execution ended but before it could be released, e.g.
+// because the attempt failed or was accepted for a callback before the next
+// heartbeat noticed the request. If the target may have acted on the job,
+// its executor is asked to compensate.
+func (s *Scheduler) finishCancelRequested(job database.ScheduledJob, executed bool) {
+	log.WithField("id", job.ID).Warn("Job was cancelled before it could be released")
+
+	cancelledBy := s.cancelledBy(job.ID)
+	errMsg := fmt.Sprintf("%s by %s", errJobCancelled, cancelledBy)
+	if executor := s.executorFor(job.JobType); executed && executor != nil {
+		run := Execution{Job: job, Attempt: job.RetryCount + 1}
+		if outcome := s.compensate(executor, run, Cancellation{CancelledBy: cancelledBy}); outcome != "" {
+			errMsg += "; " + outcome
+		}
+	}
+	s.finishCancelledJob(job.ID, errMsg)
+}
+
+// cancelledBy returns who asked for a job to be cancelled.
+func (s *Scheduler) cancelledBy(id uuid.UUID) string {
+	current, err := s.db.GetJobByID(id)
+	if err != nil {
+		log.WithField("id", id).Errorf("Failed to load cancelled job: %v", err)
+		return "unknown"
+	}
+	if current == nil || current.CancelledBy == nil {
+		return "unknown"
+	}
+	return *current.CancelledBy
+}
+
+// finishCancelledJob marks a job claimed by this worker cancelled.
+func (s *Scheduler) finishCancelledJob(id uuid.UUID, errMsg string) {
+	err := s.db.FinishCancelledJob(id, s.workerID, &errMsg)
+	if errors.Is(err, database.ErrJobNotClaimed) {
+		log.WithField("id", id).Warn("Lost claim on job before marking it cancelled")
+	} else if err != nil {
+		log.WithField("id", id).Errorf("Failed to mark job cancelled: %v", err)
+	}
+}
+
+// compensateAwaitingCallback asks the executor of a job that was cancelled
+// while waiting on its callback to undo what the target may have started.
+func (s *Scheduler) compensateAwaitingCallback(id uuid.UUID, cancelledBy string) {
+	logger := log.WithField("id", id)
+
+	job, err := s.db.GetJobByID(id)
+	if err != nil || job == nil {
+		logger.Errorf("Failed to load cancelled job for compensation: %v", err)
+		return
+	}
+
+	executor := s.executorFor(job.JobType)
+	if executor == nil {
+		return
+	}
+
+	run := Execution{Job: *job, Attempt: job.RetryCount + 1}
+	outcome := s.compensate(executor, run, Cancellation{CancelledBy: cancelledBy})
+	if outcome == "" {
+		return
+	}
+
+	errMsg := fmt.Sprintf("%s by %s; %s", errJobCancelled, cancelledBy, outcome)
+	if err := s.db.RecordJobError(id, errMsg); err != nil {
+		logger.Errorf("Failed to record compensation outcome: %v", err)
+	}
+}
+
+// compensate runs the executor's compensation, if it has one, and describes
+// the outcome for the job's error message. It returns an empty string if
+// there was nothing to compensate.
+func (s *Scheduler) compensate(executor Executor, run Execution, cancellation Cancellation) string {
+	compensator, ok := executor.(Compensator)
+	if !ok {
+		return ""
+	}
+
+	logger := log.WithField("id", run.Job.ID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), compensationTimeout)
+	defer cancel()
+
+	err := compensator.Compensate(ctx, run, cancellation)
+	switch {
+	case errors.Is(err, ErrNoCompensation):
+		return ""
+	case err != nil:
+		logger.Errorf("Compensation failed: %v", err)
+		return fmt.Sprintf("compensation failed: %v", err)
+	default:
+		logger.Info("Compensation completed")
+		return "compensation completed"
+	}
+}
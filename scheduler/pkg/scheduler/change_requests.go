@@ -0,0 +1,260 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/database"
+	log "github.com/sirupsen/logrus"
+)
+
+// errSchedulerStopped is the cancellation cause of a change request
+// execution interrupted by Stop.
+var errSchedulerStopped = errors.New("scheduler stopped")
+
+// executeChangeRequests claims approved change requests that are due and
+// runs each through the executor for its mapped job type, sharing the
+// worker pool with scheduled jobs.
+func (s *Scheduler) executeChangeRequests() {
+	if s.cfg.Scheduler.DryRun {
+		// Change requests have no dry-run status; leave them approved until
+		// dry-run mode is switched off.
+		log.Debug("Dry-run mode is on, not claiming change requests")
+		return
+	}
+
+	free, _ := s.pool.Capacity()
+	if free <= 0 {
+		log.Debug("Worker pool is full, skipping change request claim")
+		return
+	}
+
+	requests, err := s.db.ClaimChangeRequests(s.workerID, s.lease, free)
+	if err != nil {
+		log.Errorf("Failed to claim change requests: %v", err)
+		return
+	}
+
+	if len(requests) == 0 {
+		log.Debug("No approved change requests to execute")
+		return
+	}
+
+	log.Infof("Claimed %d approved change requests to execute", len(requests))
+
+	now := time.Now()
+	for _, cr := range requests {
+		jobType := database.ChangeRequestJobTypes[cr.RequestType]
+		if openAt, reason := s.calendar.NextOpen(jobType, now); openAt.After(now) {
+			s.deferChangeRequest(cr, openAt, reason)
+			continue
+		}
+		if !s.pool.Acquire(jobType, s.cfg.Scheduler.PriorityFor(jobType)) {
+			log.WithField("change_request_id", cr.ID).Debug("Worker pool filled up, returning change request to approved")
+			s.finishChangeRequest(cr, database.CRStatusApproved, cr.ErrorMessage)
+			continue
+		}
+		cr := cr
+		s.pool.Go(jobType, func() { s.executeChangeRequest(cr) })
+	}
+}
+
+// executeChangeRequest drives a claimed change request from executing to
+// completed, or back to approved for a retry, or to failed. The execution is
+// aborted if the scheduler stops or the lease is lost, and each run is
+// recorded in job_attempts like a scheduled job's.
+func (s *Scheduler) executeChangeRequest(cr database.ChangeRequest) {
+	logger := log.WithFields(log.Fields{
+		"change_request_id": cr.ID,
+		"request_type":      cr.RequestType,
+		"worker":            s.workerID,
+	})
+
+	logger.Info("Starting change request execution")
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	defer s.trackRunning(cr.ID, cancel)()
+	go func() {
+		select {
+		case <-s.stop:
+			cancel(errSchedulerStopped)
+		case <-ctx.Done():
+		}
+	}()
+
+	stopHeartbeat := s.startHeartbeat(cr.ID, s.db.RenewChangeRequestLease)
+	defer stopHeartbeat()
+
+	jobType, ok := database.ChangeRequestJobTypes[cr.RequestType]
+	if !ok {
+		errMsg := fmt.Sprintf("unknown request type: %s", cr.RequestType)
+		logger.Error(errMsg)
+		s.finishChangeRequest(cr, database.CRStatusFailed, &errMsg)
+		return
+	}
+
+	attempt := &database.JobAttempt{
+		ChangeRequestID: &cr.ID,
+		AttemptNumber:   cr.RetryCount + 1,
+		WorkerID:        s.workerID,
+	}
+	if err := s.db.CreateJobAttempt(attempt); err != nil {
+		logger.Errorf("Failed to record change request attempt: %v", err)
+		attempt = nil
+	}
+
+	executor := s.executorFor(jobType)
+	if executor == nil {
+		err := fmt.Errorf("no executor configured for job type: %s", jobType)
+		errMsg := err.Error()
+		logger.Error(errMsg)
+		s.finishAttempt(attempt, nil, 0, err)
+		s.finishChangeRequest(cr, database.CRStatusFailed, &errMsg)
+		return
+	}
+
+	start := time.Now()
+	result, err := executor.Execute(ctx, Execution{
+		Job:     changeRequestJob(cr, jobType),
+		Attempt: cr.RetryCount + 1,
+	})
+	if cause := context.Cause(ctx); cause != nil && err != nil {
+		err = fmt.Errorf("%w: %v", cause, err)
+	}
+	if err == nil {
+		err = changeRequestOutcome(result)
+	}
+	s.finishAttempt(attempt, result, time.Since(start), err)
+	if errors.Is(err, errSchedulerStopped) {
+		// Not the target's fault; run it again without using up a retry.
+		errMsg := err.Error()
+		logger.Warn("Change request interrupted by shutdown")
+		s.finishChangeRequest(cr, database.CRStatusApproved, &errMsg)
+		return
+	}
+	if errors.Is(err, errLeaseLost) {
+		logger.Warn("Change request aborted after losing its lease")
+		return
+	}
+	if err != nil {
+		logger.Errorf("Failed to execute change request: %v", err)
+		s.handleChangeRequestFailure(cr, jobType, err.Error())
+		return
+	}
+
+	logger.Info("Change request completed successfully")
+	s.finishChangeRequest(cr, database.CRStatusCompleted, nil)
+}
+
+// changeRequestJob presents a change request to an executor in the shape of
+// the scheduled job it corresponds to.
+func changeRequestJob(cr database.ChangeRequest, jobType string) database.ScheduledJob {
+	scheduleTime := cr.RequestedAt
+	if cr.ScheduleTime != nil {
+		scheduleTime = *cr.ScheduleTime
+	}
+	target := cr.TargetUserEmail
+	requestedBy := cr.RequestedBy
+
+	return database.ScheduledJob{
+		ID:              cr.ID,
+		JobType:         jobType,
+		Payload:         cr.Payload,
+		ScheduleTime:    scheduleTime,
+		Status:          cr.Status,
+		TargetUserEmail: &target,
+		RequestedBy:     &requestedBy,
+		ApprovedBy:      cr.ApprovedBy,
+		ApprovalStatus:  database.ApprovalApproved,
+		CreatedAt:       cr.CreatedAt,
+		UpdatedAt:       cr.UpdatedAt,
+		RetryCount:      cr.RetryCount,
+		ClaimedBy:       cr.ClaimedBy,
+		LeaseExpiresAt:  cr.LeaseExpiresAt,
+	}
+}
+
+// changeRequestOutcome reports a failure the target answered with 200. The
+// n8n workflows behind change requests reply {"success": false, "error": ...}
+// when they fail, which the frontend's runner treats as a failure too. A body
+// that is not JSON or has no success flag counts as success.
+func changeRequestOutcome(result *Result) error {
+	if result == nil || result.Body == nil {
+		return nil
+	}
+
+	var body struct {
+		Success *bool  `json:"success"`
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(*result.Body), &body); err != nil {
+		return nil
+	}
+	if body.Success == nil || *body.Success {
+		return nil
+	}
+
+	switch {
+	case body.Error != "":
+		return fmt.Errorf("target reported failure: %s", body.Error)
+	case body.Message != "":
+		return fmt.Errorf("target reported failure: %s", body.Message)
+	}
+	return errors.New("target reported failure")
+}
+
+// handleChangeRequestFailure retries a failed change request with backoff,
+// or marks it failed once the job type's retry budget is used up.
+func (s *Scheduler) handleChangeRequestFailure(cr database.ChangeRequest, jobType string, errorMsg string) {
+	logger := log.WithField("change_request_id", cr.ID)
+	policy := s.cfg.Scheduler.RetryPolicyFor(jobType)
+
+	if cr.RetryCount < policy.MaxRetries {
+		attempt := cr.RetryCount + 1
+		delay := retryDelay(policy, attempt)
+		logger.Infof("Scheduling change request retry %d/%d in %s", attempt, policy.MaxRetries, delay.Round(time.Second))
+
+		err := s.db.RetryChangeRequest(cr.ID, s.workerID, errorMsg, time.Now().Add(delay))
+		if errors.Is(err, database.ErrJobNotClaimed) {
+			logger.Warn("Lost claim on change request before scheduling retry")
+		} else if err != nil {
+			logger.Errorf("Failed to schedule change request retry: %v", err)
+		}
+		return
+	}
+
+	logger.Error("Max retries reached, marking change request as failed")
+	s.finishChangeRequest(cr, database.CRStatusFailed, &errorMsg)
+}
+
+// deferChangeRequest hands a claimed change request back until the
+// execution calendar opens.
+func (s *Scheduler) deferChangeRequest(cr database.ChangeRequest, until time.Time, reason string) {
+	logger := log.WithField("change_request_id", cr.ID)
+	logger.Infof("Deferring change request until %s: %s", until.In(s.location).Format(time.RFC3339), reason)
+
+	err := s.db.DeferChangeRequest(cr.ID, s.workerID, until, reason)
+	if errors.Is(err, database.ErrJobNotClaimed) {
+		logger.Warn("Lost claim on change request before deferring it")
+	} else if err != nil {
+		logger.Errorf("Failed to defer change request: %v", err)
+	}
+}
+
+// finishChangeRequest releases this worker's claim on a change request and
+// records its new status.
+func (s *Scheduler) finishChangeRequest(cr database.ChangeRequest, status string, errorMsg *string) {
+	err := s.db.FinishChangeRequest(cr.ID, s.workerID, status, errorMsg)
+	if errors.Is(err, database.ErrJobNotClaimed) {
+		log.WithField("change_request_id", cr.ID).Warnf("Lost claim on change request before setting status %s", status)
+		return
+	}
+	if err != nil {
+		log.WithField("change_request_id", cr.ID).Errorf("Failed to update change request status to %s: %v", status, err)
+	}
+}
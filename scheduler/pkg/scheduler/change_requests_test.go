@@ -0,0 +1,191 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/database"
+)
+
+func TestChangeRequestOutcome(t *testing.T) {
+	body := func(s string) *Result { return &Result{StatusCode: 200, Body: &s} }
+
+	tests := []struct {
+		name    string
+		result  *Result
+		wantErr string
+	}{
+		{name: "no result", result: nil},
+		{name: "empty body", result: &Result{StatusCode: 200}},
+		{name: "not JSON", result: body("OK")},
+		{name: "JSON array", result: body(`[{"success": false}]`)},
+		{name: "no success flag", result: body(`{"status": "done"}`)},
+		{name: "success", result: body(`{"success": true, "error": "ignored"}`)},
+		{
+			name:    "failure with error",
+			result:  body(`{"success": false, "error": "user not found"}`),
+			wantErr: "target reported failure: user not found",
+		},
+		{
+			name:    "failure with message",
+			result:  body(`{"success": false, "message": "license pool empty"}`),
+			wantErr: "target reported failure: license pool empty",
+		},
+		{
+			name:    "failure without detail",
+			result:  body(`{"success": false}`),
+			wantErr: "target reported failure",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := changeRequestOutcome(tt.result)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("changeRequestOutcome() error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("changeRequestOutcome() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChangeRequestJob(t *testing.T) {
+	requested := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	scheduled := time.Date(2026, 10, 2, 9, 0, 0, 0, time.UTC)
+	approver := "lead@example.com"
+
+	cr := database.ChangeRequest{
+		ID:              uuid.New(),
+		RequestType:     "license_change",
+		TargetUserEmail: "user@example.com",
+		RequestedBy:     "manager@example.com",
+		ApprovedBy:      &approver,
+		Payload:         database.JSONB(`{"license": "e3"}`),
+		RequestedAt:     requested,
+		RetryCount:      2,
+	}
+
+	job := changeRequestJob(cr, "modify_license")
+	if job.ID != cr.ID || job.JobType != "modify_license" || job.RetryCount != 2 {
+		t.Errorf("changeRequestJob() = %+v, want ID %s, type modify_license, retry count 2", job, cr.ID)
+	}
+	if string(job.Payload) != `{"license": "e3"}` {
+		t.Errorf("payload = %s", job.Payload)
+	}
+	if job.TargetUserEmail == nil || *job.TargetUserEmail != cr.TargetUserEmail {
+		t.Errorf("target user = %v, want %s", job.TargetUserEmail, cr.TargetUserEmail)
+	}
+	if job.ApprovalStatus != database.ApprovalApproved {
+		t.Errorf("approval status = %s, want %s", job.ApprovalStatus, database.ApprovalApproved)
+	}
+	if !job.ScheduleTime.Equal(requested) {
+		t.Errorf("schedule time without schedule_time = %s, want requested_at %s", job.ScheduleTime, requested)
+	}
+
+	cr.ScheduleTime = &scheduled
+	if job := changeRequestJob(cr, "modify_license"); !job.ScheduleTime.Equal(scheduled) {
+		t.Errorf("schedule time = %s, want %s", job.ScheduleTime, scheduled)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	tests := []struct {
+		name      string
+		renewErr  error
+		wantCause error
+	}{
+		{name: "lease renewed", renewErr: nil, wantCause: nil},
+		{name: "renewal fails transiently", renewErr: errors.New("connection reset"), wantCause: nil},
+		{name: "cancellation requested", renewErr: database.ErrCancelRequested, wantCause: errJobCancelled},
+		{name: "claim lost", renewErr: database.ErrJobNotClaimed, wantCause: errLeaseLost},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scheduler{
+				workerID:  "worker-1",
+				lease:     time.Minute,
+				heartbeat: time.Millisecond,
+				running:   map[uuid.UUID]context.CancelCauseFunc{},
+			}
+			id := uuid.New()
+
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+			defer s.trackRunning(id, cancel)()
+
+			var renewals atomic.Int32
+			stop := s.startHeartbeat(id, func(gotID uuid.UUID, workerID string, lease time.Duration) error {
+				if gotID != id || workerID != "worker-1" || lease != time.Minute {
+					return fmt.Errorf("unexpected renewal of %s by %s for %s", gotID, workerID, lease)
+				}
+				renewals.Add(1)
+				return tt.renewErr
+			})
+			defer stop()
+
+			if tt.wantCause == nil {
+				deadline := time.Now().Add(time.Second)
+				for renewals.Load() < 3 && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond)
+				}
+				if renewals.Load() < 3 {
+					t.Fatalf("lease renewed %d times, want at least 3", renewals.Load())
+				}
+				if err := context.Cause(ctx); err != nil {
+					t.Fatalf("execution aborted with %v, want it left running", err)
+				}
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+				t.Fatal("execution was not aborted")
+			}
+			if cause := context.Cause(ctx); !errors.Is(cause, tt.wantCause) {
+				t.Errorf("execution aborted with %v, want %v", cause, tt.wantCause)
+			}
+		})
+	}
+}
+
+func TestExpiredLeaseReason(t *testing.T) {
+	worker := "worker-2"
+	ended := time.Date(2026, 10, 1, 12, 30, 0, 0, time.FixedZone("EDT", -4*3600))
+
+	tests := []struct {
+		name      string
+		claimedBy *string
+		expiresAt *time.Time
+		want      string
+	}{
+		{name: "unknown owner", want: "lease expired while executing on unknown worker"},
+		{name: "owner", claimedBy: &worker, want: "lease expired while executing on worker-2"},
+		{
+			name:      "owner and expiry",
+			claimedBy: &worker,
+			expiresAt: &ended,
+			want:      "lease expired while executing on worker-2 (lease ended 2026-10-01T16:30:00Z)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expiredLeaseReason(tt.claimedBy, tt.expiresAt); got != tt.want {
+				t.Errorf("expiredLeaseReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
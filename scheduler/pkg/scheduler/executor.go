@@ -0,0 +1,382 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/config"
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/database"
+	log "github.com/sirupsen/logrus"
+)
+
+// Execution is one attempt at running a job, as handed to an Executor.
+type Execution struct {
+	Job     database.ScheduledJob
+	Attempt int // 1-based attempt number
+
+	// CallbackToken, when set, lets the executor hand the outcome off to an
+	// asynchronous callback by returning it in Result.CallbackToken.
+	// CallbackURL is where the target should POST, if known.
+	CallbackToken string
+	CallbackURL   string
+
+	// DryRun means the job must not change anything. It is only set on
+	// executions handed to a DryRunner.
+	DryRun bool
+}
+
+// Result describes what an executor did during an attempt. It is stored on
+// the job attempt record; fields that do not apply are left zero.
+type Result struct {
+	Target     string  // URL, command line, or other description of what was called
+	StatusCode int     // HTTP status, for HTTP-based executors
+	Body       *string // response body or command output, already truncated
+
+	// CallbackToken means the target accepted the job and will report the
+	// outcome later; the job waits in awaiting_callback until it does.
+	CallbackToken string
+}
+
+// Executor performs the work behind a job type. Returning an error marks the
+// attempt failed and sends the job through retry handling; the Result may
+// still be non-nil so the attempt records what the target answered.
+type Executor interface {
+	Execute(ctx context.Context, run Execution) (*Result, error)
+}
+
+// DryRunner is implemented by executors that can rehearse a job, e.g. by
+// sending it to a sandbox endpoint. Executors that do not implement it only
+// have the job's payload validated during a dry run; they are never called.
+type DryRunner interface {
+	DryRun(ctx context.Context, run Execution) (*Result, error)
+}
+
+// ExecutorFunc adapts a function to the Executor interface, so a program
+// embedding the scheduler can implement a lifecycle operation in Go and pass
+// it to RegisterExecutor. No ExecutorFunc is registered by default.
+type ExecutorFunc func(ctx context.Context, run Execution) (*Result, error)
+
+// Execute calls f(ctx, run).
+func (f ExecutorFunc) Execute(ctx context.Context, run Execution) (*Result, error) {
+	return f(ctx, run)
+}
+
+// WebhookExecutor sends the raw job payload to an HTTP endpoint and treats
+// any status other than 200 as a failure, except that a 202 defers the
+// outcome to a callback when the execution offers one. Requests that never
+// reached the target (it could not be resolved or connected to), 429 and 503
+// responses are retried up to RetryAttempts times within the same attempt.
+// Anything else, such as a timeout, may have been acted on and is not sent
+// again, since jobs like terminate are not idempotent.
+type WebhookExecutor struct {
+	URL           string
+	Method        string // defaults to POST
+	Client        *http.Client
+	Headers       map[string]string
+	Auth          config.TargetAuth
+	RetryAttempts int // HTTP requests per attempt, including the first
+	RetryDelay    time.Duration
+	Signer        *Signer // optional; signs each request body
+	CompensateURL string  // optional; notified when a running job is cancelled
+	DryRunURL     string  // optional; receives dry runs instead of URL
+}
+
+// NewWebhookExecutor builds a WebhookExecutor with its own client for the
+// target's timeout.
+func NewWebhookExecutor(target config.TargetConfig, signer *Signer) *WebhookExecutor {
+	return &WebhookExecutor{
+		URL:           target.URL,
+		Method:        target.Method,
+		Client:        &http.Client{Timeout: time.Duration(target.Timeout) * time.Second},
+		Headers:       target.Headers,
+		Auth:          target.Auth,
+		RetryAttempts: target.RetryAttempts,
+		RetryDelay:    time.Duration(target.RetryDelay) * time.Second,
+		Signer:        signer,
+		CompensateURL: target.CompensateURL,
+		DryRunURL:     target.DryRunURL,
+	}
+}
+
+// Execute implements Executor.
+func (e *WebhookExecutor) Execute(ctx context.Context, run Execution) (*Result, error) {
+	return e.call(ctx, e.URL, run)
+}
+
+// DryRun implements DryRunner by sending the job to DryRunURL, marked with
+// the dry-run header and without a callback token. Without a DryRunURL the
+// payload is only validated.
+func (e *WebhookExecutor) DryRun(ctx context.Context, run Execution) (*Result, error) {
+	if e.DryRunURL == "" {
+		return validatePayload(run)
+	}
+	run.DryRun = true
+	run.CallbackToken, run.CallbackURL = "", ""
+	return e.call(ctx, e.DryRunURL, run)
+}
+
+// call sends run to url, retrying as configured.
+func (e *WebhookExecutor) call(ctx context.Context, url string, run Execution) (*Result, error) {
+	tries := e.RetryAttempts
+	if tries < 1 {
+		tries = 1
+	}
+
+	var result *Result
+	var err error
+	for try := 1; try <= tries; try++ {
+		var retryable bool
+		result, retryable, err = e.send(ctx, url, run)
+		if err == nil || !retryable || try == tries {
+			break
+		}
+
+		log.WithFields(log.Fields{
+			"id":  run.Job.ID,
+			"url": url,
+			"try": try,
+		}).Warnf("Webhook request failed, retrying in %s: %v", e.RetryDelay, err)
+
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(e.RetryDelay):
+		}
+	}
+	return result, err
+}
+
+// send makes a single HTTP request and reports whether a failure is worth
+// retrying.
+func (e *WebhookExecutor) send(ctx context.Context, url string, run Execution) (*Result, bool, error) {
+	result := &Result{Target: url}
+
+	method := e.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(run.Job.Payload))
+	if err != nil {
+		return result, false, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(JobIDHeader, run.Job.ID.String())
+	req.Header.Set(AttemptHeader, strconv.Itoa(run.Attempt))
+	if run.CallbackToken != "" {
+		req.Header.Set(CallbackTokenHeader, run.CallbackToken)
+		if run.CallbackURL != "" {
+			req.Header.Set(CallbackURLHeader, run.CallbackURL)
+		}
+	}
+	if run.DryRun {
+		req.Header.Set(DryRunHeader, "true")
+	}
+	e.setAuth(req)
+	e.Signer.Sign(req, run.Job.Payload)
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return result, ctx.Err() == nil && notSent(err), fmt.Errorf("API call failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	result.Body = readBody(resp.Body)
+
+	if resp.StatusCode == http.StatusAccepted && run.CallbackToken != "" {
+		// Only the token the scheduler generated is trusted: it is the sole
+		// credential for reporting the outcome.
+		result.CallbackToken = run.CallbackToken
+		return result, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+		return result, retryable, fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+	return result, false, nil
+}
+
+// notSent reports whether a request error shows the request never reached
+// the target: its host could not be resolved or no connection was made.
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial" && !opErr.Timeout()
+}
+
+// CommandExecutor runs a local command with the job payload on stdin. A
+// non-zero exit status is a failure; combined output is kept on the attempt.
+type CommandExecutor struct {
+	Command []string
+	Timeout time.Duration
+}
+
+// Execute implements Executor.
+func (e *CommandExecutor) Execute(ctx context.Context, run Execution) (*Result, error) {
+	result := &Result{Target: strings.Join(e.Command, " ")}
+	if len(e.Command) == 0 {
+		return result, fmt.Errorf("no command configured")
+	}
+
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, e.Command[0], e.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(run.Job.Payload)
+	cmd.Env = append(cmd.Environ(),
+		"ONECLICK_JOB_ID="+run.Job.ID.String(),
+		"ONECLICK_JOB_TYPE="+run.Job.JobType,
+		fmt.Sprintf("ONECLICK_ATTEMPT=%d", run.Attempt),
+	)
+
+	output, err := cmd.CombinedOutput()
+	result.Body = truncateBody(output)
+	if err != nil {
+		return result, fmt.Errorf("command failed: %w", err)
+	}
+	return result, nil
+}
+
+// setAuth applies the configured headers and credentials to req.
+func (e *WebhookExecutor) setAuth(req *http.Request) {
+	for name, value := range e.Headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+	switch e.Auth.Type {
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+os.ExpandEnv(e.Auth.Token))
+	case "basic":
+		req.SetBasicAuth(os.ExpandEnv(e.Auth.Username), os.ExpandEnv(e.Auth.Password))
+	case "header":
+		req.Header.Set(e.Auth.Header, os.ExpandEnv(e.Auth.Token))
+	}
+}
+
+// Compensate implements Compensator by POSTing a description of the
+// cancelled execution to CompensateURL, so the target can roll back what it
+// may already have done. Any 2xx answer counts as success.
+func (e *WebhookExecutor) Compensate(ctx context.Context, run Execution, cancellation Cancellation) error {
+	if e.CompensateURL == "" {
+		return ErrNoCompensation
+	}
+
+	body := struct {
+		JobID       string          `json:"job_id"`
+		JobType     string          `json:"job_type"`
+		Attempt     int             `json:"attempt"`
+		CancelledBy string          `json:"cancelled_by"`
+		StatusCode  int             `json:"status_code,omitempty"`
+		Payload     json.RawMessage `json:"payload,omitempty"`
+	}{
+		JobID:       run.Job.ID.String(),
+		JobType:     run.Job.JobType,
+		Attempt:     run.Attempt,
+		CancelledBy: cancellation.CancelledBy,
+		Payload:     json.RawMessage(run.Job.Payload),
+	}
+	if cancellation.Result != nil {
+		body.StatusCode = cancellation.Result.StatusCode
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode compensation request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.CompensateURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to build compensation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(JobIDHeader, run.Job.ID.String())
+	req.Header.Set(AttemptHeader, strconv.Itoa(run.Attempt))
+	e.setAuth(req)
+	e.Signer.Sign(req, data)
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("compensation call failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("compensation endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// validatePayload is the dry run for executors that cannot rehearse a job:
+// it checks that the payload is a JSON object, as every target expects.
+func validatePayload(run Execution) (*Result, error) {
+	result := &Result{Target: "payload validation"}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(run.Job.Payload, &payload); err != nil {
+		return result, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	summary := fmt.Sprintf("dry run: payload is valid, %d top-level fields", len(payload))
+	result.Body = &summary
+	return result, nil
+}
+
+// RegisterExecutor sets the executor for a job type, replacing any executor
+// configured from the config file.
+func (s *Scheduler) RegisterExecutor(jobType string, executor Executor) {
+	s.executorsMu.Lock()
+	defer s.executorsMu.Unlock()
+	s.executors[jobType] = executor
+}
+
+// executorFor returns the executor registered for a job type, or nil.
+func (s *Scheduler) executorFor(jobType string) Executor {
+	s.executorsMu.RLock()
+	defer s.executorsMu.RUnlock()
+	return s.executors[jobType]
+}
+
+// defaultExecutors builds the executors described by the config file: a
+// webhook for every HTTP target (provision, terminate, webhooks and targets),
+// replaced by a command executor for job types listed under commands.
+func defaultExecutors(cfg *config.Config, signer *Signer) map[string]Executor {
+	executors := map[string]Executor{}
+
+	for jobType, target := range cfg.WebhookTargets() {
+		executors[jobType] = NewWebhookExecutor(target, signer)
+	}
+	for jobType, command := range cfg.Commands {
+		executors[jobType] = &CommandExecutor{
+			Command: command.Command,
+			Timeout: time.Duration(command.Timeout) * time.Second,
+		}
+	}
+
+	return executors
+}
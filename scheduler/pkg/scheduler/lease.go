@@ -0,0 +1,152 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/database"
+	log "github.com/sirupsen/logrus"
+)
+
+// errLeaseLost is the cancellation cause of an execution whose row was
+// reaped or finished elsewhere while it ran.
+var errLeaseLost = errors.New("lease lost")
+
+// leaseRenewer extends this worker's lease on a claimed row.
+type leaseRenewer func(id uuid.UUID, workerID string, lease time.Duration) error
+
+// startHeartbeat renews the lease on a claimed row until the returned stop
+// function is called. If cancellation was requested, the running execution is
+// cancelled. If the claim is lost, the execution is aborted, since another
+// worker may already be running the row, and the heartbeat stops.
+func (s *Scheduler) startHeartbeat(id uuid.UUID, renew leaseRenewer) func() {
+	done := make(chan struct{})
+	logger := log.WithFields(log.Fields{"id": id, "worker": s.workerID})
+
+	go func() {
+		ticker := time.NewTicker(s.heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := renew(id, s.workerID, s.lease)
+				if errors.Is(err, database.ErrCancelRequested) {
+					s.cancelRunning(id)
+					continue
+				}
+				if errors.Is(err, database.ErrJobNotClaimed) {
+					logger.Warn("Lease heartbeat found row no longer claimed by this worker")
+					s.abortRunning(id, errLeaseLost)
+					return
+				}
+				if err != nil {
+					logger.Errorf("Failed to renew lease: %v", err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// reapExpiredLeases returns jobs and change requests whose worker stopped
+// heartbeating to the queue, or marks them failed once the retry budget for
+// their job type is used up. Jobs whose callback deadline passed are handled
+// the same way.
+func (s *Scheduler) reapExpiredLeases() {
+	s.reapExpiredJobs()
+	s.reapExpiredChangeRequests()
+	s.timeOutCallbacks()
+}
+
+// expiredLeaseReason describes why the reaper took back a claimed row.
+func expiredLeaseReason(claimedBy *string, leaseExpiresAt *time.Time) string {
+	owner := "unknown worker"
+	if claimedBy != nil {
+		owner = *claimedBy
+	}
+	reason := fmt.Sprintf("lease expired while executing on %s", owner)
+	if leaseExpiresAt != nil {
+		reason = fmt.Sprintf("%s (lease ended %s)", reason, leaseExpiresAt.UTC().Format(time.RFC3339))
+	}
+	return reason
+}
+
+// reapExpiredJobs handles scheduled jobs with expired leases.
+func (s *Scheduler) reapExpiredJobs() {
+	jobs, err := s.db.GetExpiredLeases(s.lease)
+	if err != nil {
+		log.Errorf("Failed to query expired leases: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		logger := log.WithField("id", job.ID)
+
+		reason := expiredLeaseReason(job.ClaimedBy, job.LeaseExpiresAt)
+
+		policy := s.cfg.Scheduler.RetryPolicyFor(job.JobType)
+		status := database.StatusFailed
+		var nextAttempt *time.Time
+		switch {
+		case job.CancelRequestedAt != nil:
+			status = database.StatusCancelled
+		case job.RetryCount < policy.MaxRetries:
+			status = database.StatusPending
+			next := time.Now().Add(retryDelay(policy, job.RetryCount+1))
+			nextAttempt = &next
+		}
+
+		reaped, err := s.db.ReapJob(job, status, reason, nextAttempt)
+		if err != nil {
+			logger.Errorf("Failed to reap job: %v", err)
+			continue
+		}
+		if reaped {
+			logger.Warnf("Reaped job with expired lease, now %s: %s", status, reason)
+			if err := s.db.AbandonJobAttempts(job.ID, reason); err != nil {
+				logger.Errorf("Failed to close abandoned attempts: %v", err)
+			}
+		}
+	}
+}
+
+// reapExpiredChangeRequests handles change requests with expired leases.
+func (s *Scheduler) reapExpiredChangeRequests() {
+	requests, err := s.db.GetExpiredChangeRequestLeases()
+	if err != nil {
+		log.Errorf("Failed to query expired change request leases: %v", err)
+		return
+	}
+
+	for _, cr := range requests {
+		logger := log.WithField("change_request_id", cr.ID)
+		reason := expiredLeaseReason(cr.ClaimedBy, cr.LeaseExpiresAt)
+
+		policy := s.cfg.Scheduler.RetryPolicyFor(database.ChangeRequestJobTypes[cr.RequestType])
+		status := database.CRStatusFailed
+		var nextAttempt *time.Time
+		if cr.RetryCount < policy.MaxRetries {
+			status = database.CRStatusApproved
+			next := time.Now().Add(retryDelay(policy, cr.RetryCount+1))
+			nextAttempt = &next
+		}
+
+		reaped, err := s.db.ReapChangeRequest(cr, status, reason, nextAttempt)
+		if err != nil {
+			logger.Errorf("Failed to reap change request: %v", err)
+			continue
+		}
+		if reaped {
+			logger.Warnf("Reaped change request with expired lease, now %s: %s", status, reason)
+			if err := s.db.AbandonJobAttempts(cr.ID, reason); err != nil {
+				logger.Errorf("Failed to close abandoned attempts: %v", err)
+			}
+		}
+	}
+}
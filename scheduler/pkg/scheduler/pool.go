@@ -0,0 +1,177 @@
+package scheduler
+
+import (
+	"sync"
+)
+
+// defaultWorkers is used when scheduler.workers is not set.
+const defaultWorkers = 10
+
+// Pool bounds how many jobs execute at once, both overall and per job type.
+// Slots are reserved with Acquire before a job is claimed and handed to Go,
+// which runs the job and frees the slot when it returns. The last reserved
+// slots are kept for jobs at or above the urgent priority, so a backlog of
+// ordinary work cannot delay them.
+type Pool struct {
+	mu       sync.Mutex
+	size     int
+	limits   map[string]int
+	inFlight map[string]int
+	total    int
+	reserved int
+	urgent   int
+}
+
+// PoolStats is a point-in-time view of a Pool.
+type PoolStats struct {
+	Workers        int            `json:"workers"`
+	InFlight       int            `json:"in_flight"`
+	InFlightByType map[string]int `json:"in_flight_by_type"`
+	Limits         map[string]int `json:"limits,omitempty"`
+	Reserved       int            `json:"reserved,omitempty"`
+}
+
+// NewPool creates a pool with size global slots and optional per job type
+// limits. A limit larger than size is effectively capped by size. reserved
+// of the slots may only be used by jobs with a priority of at least urgent.
+func NewPool(size int, limits map[string]int, reserved, urgent int) *Pool {
+	if size <= 0 {
+		size = defaultWorkers
+	}
+	if reserved >= size {
+		reserved = size - 1
+	}
+	if reserved < 0 {
+		reserved = 0
+	}
+	copied := make(map[string]int, len(limits))
+	for jobType, limit := range limits {
+		copied[jobType] = limit
+	}
+	return &Pool{
+		size:     size,
+		limits:   copied,
+		inFlight: map[string]int{},
+		reserved: reserved,
+		urgent:   urgent,
+	}
+}
+
+// Capacity returns the number of free global slots and, for every job type
+// with a limit, how many more jobs of that type may start.
+func (p *Pool) Capacity() (int, map[string]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	free := p.size - p.total
+	perType := make(map[string]int, len(p.limits))
+	for jobType, limit := range p.limits {
+		remaining := limit - p.inFlight[jobType]
+		if remaining < 0 {
+			remaining = 0
+		}
+		perType[jobType] = remaining
+	}
+	return free, perType
+}
+
+// Reservation returns how many slots are kept for urgent jobs and the
+// priority a job needs to use them.
+func (p *Pool) Reservation() (int, int) {
+	return p.reserved, p.urgent
+}
+
+// Acquire reserves a slot for a job of the given type and priority. It
+// returns false if the pool or the type's limit is full, or if only reserved
+// slots are left and the job is not urgent.
+func (p *Pool) Acquire(jobType string, priority int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	size := p.size
+	if priority < p.urgent {
+		size -= p.reserved
+	}
+	if p.total >= size {
+		return false
+	}
+	if limit, ok := p.limits[jobType]; ok && p.inFlight[jobType] >= limit {
+		return false
+	}
+	p.total++
+	p.inFlight[jobType]++
+	return true
+}
+
+// Release frees a slot previously reserved with Acquire.
+func (p *Pool) Release(jobType string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.total--
+	p.inFlight[jobType]--
+	if p.inFlight[jobType] <= 0 {
+		delete(p.inFlight, jobType)
+	}
+}
+
+// Go runs fn in a new goroutine using a slot already reserved with Acquire,
+// releasing the slot when fn returns.
+func (p *Pool) Go(jobType string, fn func()) {
+	go func() {
+		defer p.Release(jobType)
+		fn()
+	}()
+}
+
+// Stats returns the current pool usage.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	byType := make(map[string]int, len(p.inFlight))
+	for jobType, n := range p.inFlight {
+		byType[jobType] = n
+	}
+	limits := make(map[string]int, len(p.limits))
+	for jobType, n := range p.limits {
+		limits[jobType] = n
+	}
+	return PoolStats{
+		Workers:        p.size,
+		InFlight:       p.total,
+		InFlightByType: byType,
+		Limits:         limits,
+		Reserved:       p.reserved,
+	}
+}
+
+// Stats describes the scheduler's execution load: the local worker pool and
+// the shared queue of due jobs waiting to be claimed.
+type Stats struct {
+	WorkerID         string         `json:"worker_id"`
+	Pool             PoolStats      `json:"pool"`
+	QueueDepth       int            `json:"queue_depth"`
+	QueueDepthByType map[string]int `json:"queue_depth_by_type"`
+}
+
+// Stats reports in-flight counts for this instance and the queue depth
+// across all instances.
+func (s *Scheduler) Stats() (Stats, error) {
+	due, err := s.db.CountDueJobs()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	total := 0
+	for _, n := range due {
+		total += n
+	}
+
+	return Stats{
+		WorkerID:         s.workerID,
+		Pool:             s.pool.Stats(),
+		QueueDepth:       total,
+		QueueDepthByType: due,
+	}, nil
+}
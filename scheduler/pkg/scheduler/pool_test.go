@@ -0,0 +1,175 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// acquire is one Pool.Acquire call and its expected outcome.
+type acquire struct {
+	jobType  string
+	priority int
+	want     bool
+}
+
+func TestPoolAcquire(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		limits   map[string]int
+		reserved int
+		urgent   int
+		calls    []acquire
+	}{
+		{
+			name: "global limit",
+			size: 2,
+			calls: []acquire{
+				{jobType: "provision", want: true},
+				{jobType: "terminate", want: true},
+				{jobType: "provision", want: false},
+			},
+		},
+		{
+			name:   "per type limit leaves room for other types",
+			size:   3,
+			limits: map[string]int{"terminate": 1},
+			calls: []acquire{
+				{jobType: "terminate", want: true},
+				{jobType: "terminate", want: false},
+				{jobType: "provision", want: true},
+				{jobType: "provision", want: true},
+				{jobType: "provision", want: false},
+			},
+		},
+		{
+			name:   "zero limit blocks the type",
+			size:   2,
+			limits: map[string]int{"terminate": 0},
+			calls: []acquire{
+				{jobType: "terminate", want: false},
+				{jobType: "provision", want: true},
+			},
+		},
+		{
+			name:     "reserved slots are kept for urgent jobs",
+			size:     3,
+			reserved: 1,
+			urgent:   10,
+			calls: []acquire{
+				{jobType: "provision", priority: 0, want: true},
+				{jobType: "provision", priority: 9, want: true},
+				{jobType: "provision", priority: 9, want: false},
+				{jobType: "terminate", priority: 10, want: true},
+				{jobType: "terminate", priority: 50, want: false},
+			},
+		},
+		{
+			name:     "urgent jobs may also use ordinary slots",
+			size:     2,
+			reserved: 1,
+			urgent:   5,
+			calls: []acquire{
+				{jobType: "provision", priority: 5, want: true},
+				{jobType: "provision", priority: 5, want: true},
+				{jobType: "provision", priority: 0, want: false},
+			},
+		},
+		{
+			name:     "urgent jobs still respect per type limits",
+			size:     3,
+			limits:   map[string]int{"terminate": 1},
+			reserved: 1,
+			urgent:   5,
+			calls: []acquire{
+				{jobType: "terminate", priority: 5, want: true},
+				{jobType: "terminate", priority: 5, want: false},
+			},
+		},
+		{
+			name:     "reservation never takes every slot",
+			size:     2,
+			reserved: 5,
+			urgent:   5,
+			calls: []acquire{
+				{jobType: "provision", priority: 0, want: true},
+				{jobType: "provision", priority: 0, want: false},
+				{jobType: "provision", priority: 5, want: true},
+			},
+		},
+		{
+			name: "default size",
+			size: 0,
+			calls: func() []acquire {
+				calls := make([]acquire, 0, defaultWorkers+1)
+				for i := 0; i < defaultWorkers; i++ {
+					calls = append(calls, acquire{jobType: "provision", want: true})
+				}
+				return append(calls, acquire{jobType: "provision", want: false})
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool(tt.size, tt.limits, tt.reserved, tt.urgent)
+			for i, call := range tt.calls {
+				if got := p.Acquire(call.jobType, call.priority); got != call.want {
+					t.Fatalf("call %d: Acquire(%q, %d) = %v, want %v", i, call.jobType, call.priority, got, call.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPoolCapacity(t *testing.T) {
+	p := NewPool(4, map[string]int{"terminate": 2, "modify_license": 1}, 0, 0)
+
+	assertCapacity := func(wantFree int, wantPerType map[string]int) {
+		t.Helper()
+		free, perType := p.Capacity()
+		if free != wantFree || !reflect.DeepEqual(perType, wantPerType) {
+			t.Errorf("Capacity() = %d, %v, want %d, %v", free, perType, wantFree, wantPerType)
+		}
+	}
+
+	assertCapacity(4, map[string]int{"terminate": 2, "modify_license": 1})
+
+	if !p.Acquire("terminate", 0) || !p.Acquire("provision", 0) || !p.Acquire("modify_license", 0) {
+		t.Fatal("Acquire() failed on an empty pool")
+	}
+	assertCapacity(1, map[string]int{"terminate": 1, "modify_license": 0})
+
+	p.Release("modify_license")
+	p.Release("terminate")
+	assertCapacity(3, map[string]int{"terminate": 2, "modify_license": 1})
+
+	stats := p.Stats()
+	if stats.InFlight != 1 || !reflect.DeepEqual(stats.InFlightByType, map[string]int{"provision": 1}) {
+		t.Errorf("Stats() = %+v, want one provision job in flight", stats)
+	}
+}
+
+func TestPoolGoReleases(t *testing.T) {
+	p := NewPool(1, nil, 0, 0)
+	if !p.Acquire("provision", 0) {
+		t.Fatal("Acquire() failed on an empty pool")
+	}
+
+	ran := make(chan struct{})
+	p.Go("provision", func() { close(ran) })
+	<-ran
+
+	// The slot is released just after fn returns.
+	deadline := time.Now().Add(time.Second)
+	for {
+		if free, _ := p.Capacity(); free == 1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("slot was not released after the job returned")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,332 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRecurrenceDays bounds the search for the next RRULE occurrence, so a
+// rule that never matches cannot loop forever.
+const maxRecurrenceDays = 366 * 10
+
+// Recurrence yields the occurrences of a recurring job schedule.
+type Recurrence interface {
+	// Next returns the first occurrence strictly after t, or the zero time
+	// if there is none.
+	Next(t time.Time) time.Time
+}
+
+// ParseRecurrence parses a cron expression or an RRULE (with or without the
+// "RRULE:" prefix). Occurrences are computed in loc and never fall before
+// start.
+//
+// Only a subset of RFC 5545 is supported: FREQ (DAILY, WEEKLY, MONTHLY,
+// YEARLY), INTERVAL, BYDAY (with ordinals such as 1MO or -1FR for monthly
+// and yearly rules), BYMONTHDAY, BYMONTH, BYHOUR, BYMINUTE and UNTIL.
+// Times not given by BYHOUR or BYMINUTE are taken from start.
+func ParseRecurrence(expr string, start time.Time, loc *time.Location) (Recurrence, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.Contains(strings.ToUpper(expr), "FREQ=") {
+		return parseRRule(expr, start, loc)
+	}
+
+	sched, err := cronParser.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression: %w", err)
+	}
+	return cronRecurrence{next: sched.Next, start: start, loc: loc}, nil
+}
+
+// cronRecurrence evaluates a cron schedule in a fixed timezone.
+type cronRecurrence struct {
+	next  func(time.Time) time.Time
+	start time.Time
+	loc   *time.Location
+}
+
+func (c cronRecurrence) Next(t time.Time) time.Time {
+	if t.Before(c.start) {
+		t = c.start.Add(-time.Second)
+	}
+	return c.next(t.In(c.loc))
+}
+
+// rrule is a parsed RRULE.
+type rrule struct {
+	freq       string
+	interval   int
+	byDay      []weekdayNum
+	byMonthDay []int
+	byMonth    []time.Month
+	hours      []int
+	minutes    []int
+	until      time.Time
+	start      time.Time
+	loc        *time.Location
+}
+
+// weekdayNum is a BYDAY entry; ord is 0 for every such weekday, otherwise
+// the 1-based (or, if negative, from the end) occurrence within the period.
+type weekdayNum struct {
+	ord int
+	day time.Weekday
+}
+
+var icsWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseRRule(expr string, start time.Time, loc *time.Location) (*rrule, error) {
+	expr = strings.TrimPrefix(strings.TrimPrefix(expr, "RRULE:"), "rrule:")
+
+	start = start.In(loc)
+	r := &rrule{interval: 1, start: start, loc: loc}
+
+	for _, part := range strings.Split(expr, ";") {
+		if part == "" {
+			continue
+		}
+		eq := strings.Index(part, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid RRULE part %q", part)
+		}
+		name, value := strings.ToUpper(part[:eq]), strings.ToUpper(part[eq+1:])
+
+		var err error
+		switch name {
+		case "FREQ":
+			switch value {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				r.freq = value
+			default:
+				return nil, fmt.Errorf("unsupported RRULE FREQ %q", value)
+			}
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(value)
+			if err == nil && r.interval < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		case "BYDAY":
+			r.byDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			r.byMonthDay, err = parseIntList(value, -31, 31)
+		case "BYMONTH":
+			var months []int
+			months, err = parseIntList(value, 1, 12)
+			for _, m := range months {
+				r.byMonth = append(r.byMonth, time.Month(m))
+			}
+		case "BYHOUR":
+			r.hours, err = parseIntList(value, 0, 23)
+		case "BYMINUTE":
+			r.minutes, err = parseIntList(value, 0, 59)
+		case "UNTIL":
+			var dateOnly bool
+			r.until, dateOnly, err = parseICSTime(value, nil, loc)
+			if err == nil && dateOnly {
+				r.until = r.until.AddDate(0, 0, 1).Add(-time.Second)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported RRULE part %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("RRULE %s: %w", name, err)
+		}
+	}
+
+	if r.freq == "" {
+		return nil, fmt.Errorf("RRULE needs FREQ")
+	}
+	if r.hours == nil {
+		r.hours = []int{start.Hour()}
+	}
+	if r.minutes == nil {
+		r.minutes = []int{start.Minute()}
+	}
+	sort.Ints(r.hours)
+	sort.Ints(r.minutes)
+	return r, nil
+}
+
+func (r *rrule) Next(t time.Time) time.Time {
+	if t.Before(r.start) {
+		t = r.start.Add(-time.Second)
+	}
+	t = t.In(r.loc)
+
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, r.loc)
+	for i := 0; i < maxRecurrenceDays; i++ {
+		d := day.AddDate(0, 0, i)
+		if !r.matches(d) {
+			continue
+		}
+		for _, h := range r.hours {
+			for _, m := range r.minutes {
+				occurrence := time.Date(d.Year(), d.Month(), d.Day(), h, m, r.start.Second(), 0, r.loc)
+				if !occurrence.After(t) || occurrence.Before(r.start) {
+					continue
+				}
+				if !r.until.IsZero() && occurrence.After(r.until) {
+					return time.Time{}
+				}
+				return occurrence
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// matches reports whether day (midnight in r.loc) has occurrences.
+func (r *rrule) matches(day time.Time) bool {
+	start := r.start
+	if civilDays(start, day) < 0 {
+		return false
+	}
+	if len(r.byMonth) > 0 && !containsMonth(r.byMonth, day.Month()) {
+		return false
+	}
+
+	switch r.freq {
+	case "DAILY":
+		if civilDays(start, day)%r.interval != 0 {
+			return false
+		}
+		return r.matchesWeekday(day) && r.matchesMonthDay(day)
+	case "WEEKLY":
+		weeks := civilDays(weekStart(start), weekStart(day)) / 7
+		if weeks%r.interval != 0 {
+			return false
+		}
+		if len(r.byDay) == 0 {
+			return day.Weekday() == start.Weekday()
+		}
+		return r.matchesWeekday(day)
+	case "MONTHLY":
+		months := (day.Year()-start.Year())*12 + int(day.Month()-start.Month())
+		if months%r.interval != 0 {
+			return false
+		}
+		return r.matchesDayInMonth(day)
+	case "YEARLY":
+		if (day.Year()-start.Year())%r.interval != 0 {
+			return false
+		}
+		if len(r.byMonth) == 0 && day.Month() != start.Month() {
+			return false
+		}
+		return r.matchesDayInMonth(day)
+	}
+	return false
+}
+
+// matchesDayInMonth applies BYDAY and BYMONTHDAY within a month, defaulting
+// to the day of the month of the start.
+func (r *rrule) matchesDayInMonth(day time.Time) bool {
+	if len(r.byDay) == 0 && len(r.byMonthDay) == 0 {
+		return day.Day() == r.start.Day()
+	}
+	if len(r.byDay) > 0 && !r.matchesWeekday(day) {
+		return false
+	}
+	return r.matchesMonthDay(day)
+}
+
+// matchesWeekday applies BYDAY; ordinals count within the month.
+func (r *rrule) matchesWeekday(day time.Time) bool {
+	if len(r.byDay) == 0 {
+		return true
+	}
+	daysInMonth := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, r.loc).Day()
+	for _, wd := range r.byDay {
+		if wd.day != day.Weekday() {
+			continue
+		}
+		switch {
+		case wd.ord == 0:
+			return true
+		case wd.ord > 0 && (day.Day()-1)/7+1 == wd.ord:
+			return true
+		case wd.ord < 0 && (daysInMonth-day.Day())/7+1 == -wd.ord:
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthDay applies BYMONTHDAY; negative values count from the end of
+// the month. With no BYMONTHDAY every day matches.
+func (r *rrule) matchesMonthDay(day time.Time) bool {
+	if len(r.byMonthDay) == 0 {
+		return true
+	}
+	daysInMonth := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, r.loc).Day()
+	for _, md := range r.byMonthDay {
+		if md == day.Day() || (md < 0 && daysInMonth+md+1 == day.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+// civilDays counts calendar days from a to b, ignoring DST shifts.
+func civilDays(a, b time.Time) int {
+	ua := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	ub := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(ub.Sub(ua).Hours() / 24)
+}
+
+// weekStart returns the Monday on or before t, as RRULE weeks start on
+// Monday by default.
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return t.AddDate(0, 0, -offset)
+}
+
+func containsMonth(months []time.Month, m time.Month) bool {
+	for _, month := range months {
+		if month == m {
+			return true
+		}
+	}
+	return false
+}
+
+func parseByDay(value string) ([]weekdayNum, error) {
+	var days []weekdayNum
+	for _, item := range strings.Split(value, ",") {
+		if len(item) < 2 {
+			return nil, fmt.Errorf("invalid day %q", item)
+		}
+		code := item[len(item)-2:]
+		wd, ok := icsWeekdays[code]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", item)
+		}
+		ord := 0
+		if prefix := item[:len(item)-2]; prefix != "" {
+			n, err := strconv.Atoi(prefix)
+			if err != nil || n == 0 || n < -5 || n > 5 {
+				return nil, fmt.Errorf("invalid day %q", item)
+			}
+			ord = n
+		}
+		days = append(days, weekdayNum{ord: ord, day: wd})
+	}
+	return days, nil
+}
+
+func parseIntList(value string, min, max int) ([]int, error) {
+	var values []int
+	for _, item := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(item)
+		if err != nil || n < min || n > max || n == 0 && min < 0 {
+			return nil, fmt.Errorf("invalid value %q", item)
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
@@ -0,0 +1,166 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+// occurrences returns the first n occurrences of r at or after from.
+func occurrences(r Recurrence, from time.Time, n int) []time.Time {
+	var got []time.Time
+	t := from.Add(-time.Second)
+	for len(got) < n {
+		t = r.Next(t)
+		if t.IsZero() {
+			break
+		}
+		got = append(got, t)
+	}
+	return got
+}
+
+func TestParseRecurrenceSequences(t *testing.T) {
+	ny := mustLoadLocation(t, "America/New_York")
+	at := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, ny)
+	}
+
+	tests := []struct {
+		name  string
+		expr  string
+		start time.Time
+		from  time.Time
+		want  []time.Time
+		// bounded rules are asked for one more occurrence than they have.
+		bounded bool
+	}{
+		{
+			name:  "last friday of the month",
+			expr:  "RRULE:FREQ=MONTHLY;BYDAY=-1FR",
+			start: at(2026, 1, 1, 10, 0),
+			want: []time.Time{
+				at(2026, 1, 30, 10, 0), at(2026, 2, 27, 10, 0), at(2026, 3, 27, 10, 0),
+				at(2026, 4, 24, 10, 0), at(2026, 5, 29, 10, 0),
+			},
+		},
+		{
+			name:  "every other week on monday and thursday",
+			expr:  "INTERVAL=2;FREQ=WEEKLY;BYDAY=MO,TH",
+			start: at(2026, 10, 12, 8, 0),
+			want: []time.Time{
+				at(2026, 10, 12, 8, 0), at(2026, 10, 15, 8, 0), at(2026, 10, 26, 8, 0),
+				at(2026, 10, 29, 8, 0), at(2026, 11, 9, 8, 0), at(2026, 11, 12, 8, 0),
+			},
+		},
+		{
+			name:  "weekly without BYDAY repeats the start weekday",
+			expr:  "FREQ=WEEKLY",
+			start: at(2026, 10, 14, 7, 15),
+			want:  []time.Time{at(2026, 10, 14, 7, 15), at(2026, 10, 21, 7, 15), at(2026, 10, 28, 7, 15)},
+		},
+		{
+			name:  "last day of the month",
+			expr:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: at(2026, 1, 15, 23, 0),
+			want:  []time.Time{at(2026, 1, 31, 23, 0), at(2026, 2, 28, 23, 0), at(2026, 3, 31, 23, 0), at(2026, 4, 30, 23, 0)},
+		},
+		{
+			name:  "fourth thursday of november",
+			expr:  "FREQ=YEARLY;BYMONTH=11;BYDAY=4TH",
+			start: at(2026, 1, 1, 12, 0),
+			want:  []time.Time{at(2026, 11, 26, 12, 0), at(2027, 11, 25, 12, 0), at(2028, 11, 23, 12, 0)},
+		},
+		{
+			name:  "daily hours keep their wall clock across spring forward",
+			expr:  "FREQ=DAILY;BYHOUR=9,17;BYMINUTE=0",
+			start: at(2026, 3, 7, 0, 0),
+			want: []time.Time{
+				at(2026, 3, 7, 9, 0), at(2026, 3, 7, 17, 0), at(2026, 3, 8, 9, 0),
+				at(2026, 3, 8, 17, 0), at(2026, 3, 9, 9, 0),
+			},
+		},
+		{
+			name:    "date-only UNTIL includes its day",
+			expr:    "FREQ=DAILY;UNTIL=20261014",
+			start:   at(2026, 10, 12, 9, 0),
+			want:    []time.Time{at(2026, 10, 12, 9, 0), at(2026, 10, 13, 9, 0), at(2026, 10, 14, 9, 0)},
+			bounded: true,
+		},
+		{
+			name:  "nothing before start",
+			expr:  "FREQ=DAILY",
+			start: at(2026, 10, 12, 9, 0),
+			from:  at(2026, 10, 1, 0, 0),
+			want:  []time.Time{at(2026, 10, 12, 9, 0), at(2026, 10, 13, 9, 0)},
+		},
+		{
+			name:  "cron keeps the definition timezone across spring forward",
+			expr:  "0 9 * * *",
+			start: at(2026, 3, 7, 0, 0),
+			from:  at(2026, 3, 7, 0, 0).UTC(),
+			want:  []time.Time{at(2026, 3, 7, 9, 0), at(2026, 3, 8, 9, 0), at(2026, 3, 9, 9, 0)},
+		},
+		{
+			name:  "cron keeps the definition timezone across fall back",
+			expr:  "30 8 * * MON-FRI",
+			start: at(2026, 10, 30, 0, 0),
+			from:  at(2026, 10, 30, 0, 0).UTC(),
+			want:  []time.Time{at(2026, 10, 30, 8, 30), at(2026, 11, 2, 8, 30), at(2026, 11, 3, 8, 30)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseRecurrence(tt.expr, tt.start, ny)
+			if err != nil {
+				t.Fatalf("ParseRecurrence(%q) error: %v", tt.expr, err)
+			}
+			from := tt.from
+			if from.IsZero() {
+				from = tt.start
+			}
+
+			n := len(tt.want)
+			if tt.bounded {
+				n++
+			}
+			got := occurrences(r, from, n)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d occurrences %v, want %d %v", len(got), got, len(tt.want), tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("occurrence %d = %s, want %s", i, got[i], tt.want[i])
+				}
+				if got[i].Hour() != tt.want[i].Hour() {
+					t.Errorf("occurrence %d hour = %d in %s, want %d", i, got[i].Hour(), got[i].Location(), tt.want[i].Hour())
+				}
+			}
+		})
+	}
+}
+
+func TestParseRecurrenceErrors(t *testing.T) {
+	start := time.Date(2026, 10, 12, 9, 0, 0, 0, time.UTC)
+
+	for _, expr := range []string{
+		"FREQ=HOURLY",
+		"INTERVAL=2",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYDAY=6FR",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=YEARLY;BYMONTH=13",
+		"FREQ=DAILY;BYHOUR=24",
+		"FREQ=DAILY;COUNT=3",
+		"FREQ=DAILY;BYDAY",
+		"FREQ=DAILY;UNTIL=soon",
+		"61 * * * *",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := ParseRecurrence(expr, start, time.UTC); err == nil {
+				t.Errorf("ParseRecurrence(%q) succeeded, want error", expr)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/database"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultRecurringHorizon is used when scheduler.recurring_horizon is not set.
+const defaultRecurringHorizon = 7 * 24 * time.Hour
+
+// maxOccurrencesPerRun bounds how many jobs one definition materializes per
+// tick, so a very frequent schedule cannot flood the table at once.
+const maxOccurrencesPerRun = 100
+
+// recurringHorizon is how far ahead occurrences are materialized.
+func (s *Scheduler) recurringHorizon() time.Duration {
+	if s.cfg.Scheduler.RecurringHorizon > 0 {
+		return time.Duration(s.cfg.Scheduler.RecurringHorizon) * time.Second
+	}
+	return defaultRecurringHorizon
+}
+
+// RecurrenceFor parses the schedule of a recurring job definition in its
+// timezone.
+func (s *Scheduler) RecurrenceFor(rj database.RecurringJob) (Recurrence, error) {
+	loc := s.location
+	if rj.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(rj.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", rj.Timezone)
+		}
+	}
+	return ParseRecurrence(rj.Schedule, rj.StartTime, loc)
+}
+
+// materializeRecurring creates pending jobs for the upcoming occurrences of
+// every active recurring job definition.
+func (s *Scheduler) materializeRecurring() {
+	definitions, err := s.db.ListRecurringJobs()
+	if err != nil {
+		log.Errorf("Failed to list recurring jobs: %v", err)
+		return
+	}
+
+	for _, rj := range definitions {
+		if rj.Paused {
+			continue
+		}
+		if _, err := s.MaterializeRecurring(rj); err != nil {
+			log.WithField("recurring_job_id", rj.ID).Errorf("Failed to materialize recurring job: %v", err)
+		}
+	}
+}
+
+// MaterializeRecurring creates pending jobs for the occurrences of rj that
+// fall within the horizon, and always for the next occurrence so it can be
+// seen and edited ahead of time. Occurrences that were missed, e.g. while the
+// scheduler was down, are not backfilled. It returns the number of jobs
+// created.
+func (s *Scheduler) MaterializeRecurring(rj database.RecurringJob) (int, error) {
+	recurrence, err := s.RecurrenceFor(rj)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	from := now
+	if rj.MaterializedUntil != nil && rj.MaterializedUntil.After(from) {
+		from = *rj.MaterializedUntil
+	}
+	// Nothing upcoming exists yet, so take the next occurrence even if it
+	// is beyond the horizon.
+	needNext := rj.MaterializedUntil == nil || !rj.MaterializedUntil.After(now)
+	horizon := now.Add(s.recurringHorizon())
+
+	var occurrences []time.Time
+	for len(occurrences) < maxOccurrencesPerRun {
+		next := recurrence.Next(from)
+		if next.IsZero() || (rj.EndTime != nil && next.After(*rj.EndTime)) {
+			break
+		}
+		if next.After(horizon) && !(needNext && len(occurrences) == 0) {
+			break
+		}
+		occurrences = append(occurrences, next.UTC())
+		from = next
+	}
+
+	return s.db.MaterializeOccurrences(rj, occurrences, s.cfg.Scheduler.PriorityFor(rj.JobType))
+}
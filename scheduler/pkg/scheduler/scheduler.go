@@ -0,0 +1,588 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/config"
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/database"
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultLeaseDuration is used when scheduler.lease_duration is not set.
+const defaultLeaseDuration = 10 * time.Minute
+
+// cronParser accepts standard 5-field cron expressions as well as 6-field
+// ones with a leading seconds field, plus descriptors such as @hourly.
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// Scheduler manages scheduled provisioning jobs
+type Scheduler struct {
+	db        *database.DB
+	cfg       *config.Config
+	cron      *cron.Cron
+	location  *time.Location
+	calendar  *Calendar
+	client    *http.Client
+	signer    *Signer
+	pool      *Pool
+	workerID  string
+	lease     time.Duration
+	heartbeat time.Duration
+	stop      chan struct{}
+
+	runningMu sync.Mutex
+	running   map[uuid.UUID]context.CancelCauseFunc
+
+	executorsMu sync.RWMutex
+	executors   map[string]Executor
+}
+
+// New creates a new Scheduler instance
+func New(db *database.DB, cfg *config.Config) *Scheduler {
+	workerID := cfg.Scheduler.WorkerID
+	if workerID == "" {
+		workerID = defaultWorkerID()
+	}
+
+	lease := time.Duration(cfg.Scheduler.LeaseDuration) * time.Second
+	if lease <= 0 {
+		lease = defaultLeaseDuration
+	}
+
+	heartbeat := time.Duration(cfg.Scheduler.HeartbeatInterval) * time.Second
+	if heartbeat <= 0 || heartbeat >= lease {
+		heartbeat = lease / 3
+	}
+
+	client := &http.Client{
+		Timeout: time.Duration(cfg.Provisioning.Timeout) * time.Second,
+	}
+
+	signer := NewSigner(cfg.Signing)
+
+	loc, err := cfg.Scheduler.Location()
+	if err != nil {
+		log.Warnf("Falling back to UTC: %v", err)
+		loc = time.UTC
+	}
+
+	return &Scheduler{
+		db:        db,
+		cfg:       cfg,
+		cron:      cron.New(cron.WithLocation(loc), cron.WithParser(cronParser)),
+		location:  loc,
+		client:    client,
+		signer:    signer,
+		executors: defaultExecutors(cfg, signer),
+		pool:      NewPool(cfg.Scheduler.Workers, cfg.Scheduler.Concurrency, cfg.Scheduler.ReservedWorkers, cfg.Scheduler.UrgentPriority),
+		workerID:  workerID,
+		lease:     lease,
+		heartbeat: heartbeat,
+		stop:      make(chan struct{}),
+		running:   map[uuid.UUID]context.CancelCauseFunc{},
+	}
+}
+
+// defaultWorkerID builds an identifier that is unique per process, even when
+// containers reuse the same hostname and PID across restarts.
+func defaultWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "scheduler"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.New().String()[:8])
+}
+
+// Location returns the timezone cron specs are evaluated in.
+func (s *Scheduler) Location() *time.Location {
+	return s.location
+}
+
+// WorkerID returns the identifier this scheduler uses when claiming jobs.
+func (s *Scheduler) WorkerID() string {
+	return s.workerID
+}
+
+// Start begins the scheduler
+func (s *Scheduler) Start() error {
+	calendar, err := NewCalendar(s.cfg.Calendar, s.location)
+	if err != nil {
+		return fmt.Errorf("failed to load execution calendar: %w", err)
+	}
+	s.calendar = calendar
+
+	_, err = s.cron.AddFunc(s.cfg.Scheduler.CheckInterval, s.checkAndExecute)
+	if err != nil {
+		return fmt.Errorf("failed to add job executor cron: %w", err)
+	}
+
+	_, err = s.cron.AddFunc(s.cfg.Scheduler.CheckInterval, s.executeChangeRequests)
+	if err != nil {
+		return fmt.Errorf("failed to add change request executor cron: %w", err)
+	}
+
+	_, err = s.cron.AddFunc(s.cfg.Scheduler.CheckInterval, s.reapExpiredLeases)
+	if err != nil {
+		return fmt.Errorf("failed to add lease reaper cron: %w", err)
+	}
+
+	_, err = s.cron.AddFunc(s.cfg.Scheduler.CheckInterval, s.materializeRecurring)
+	if err != nil {
+		return fmt.Errorf("failed to add recurring job cron: %w", err)
+	}
+
+	if s.cfg.DirectorySync.Enabled && s.cfg.DirectorySync.APIURL != "" {
+		interval := s.cfg.DirectorySync.Interval
+		if interval == "" {
+			interval = "0 * * * *" // default: hourly
+		}
+		_, err = s.cron.AddFunc(interval, s.runDirectorySync)
+		if err != nil {
+			return fmt.Errorf("failed to add directory sync cron: %w", err)
+		}
+		log.Infof("Directory sync scheduled: %s", interval)
+	}
+
+	s.cron.Start()
+
+	if s.cfg.Scheduler.ListenNotify {
+		if err := s.startWakeups(); err != nil {
+			log.Warnf("Failed to start wake-up listener, relying on polling: %v", err)
+		}
+	}
+
+	log.Infof("Scheduler started successfully (timezone %s)", s.location)
+	return nil
+}
+
+// runDirectorySync calls the frontend API to trigger a directory sync.
+func (s *Scheduler) runDirectorySync() {
+	logger := log.WithField("job", "directory_sync")
+	logger.Info("Triggering directory sync")
+
+	req, err := http.NewRequest(http.MethodPost, s.cfg.DirectorySync.APIURL, nil)
+	if err != nil {
+		logger.Errorf("Failed to build sync request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.DirectorySync.APIKey != "" {
+		req.Header.Set("x-internal-api-key", s.cfg.DirectorySync.APIKey)
+	}
+	s.signer.Sign(req, nil)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		logger.Errorf("Directory sync request failed: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Errorf("Directory sync returned status %d", resp.StatusCode)
+		return
+	}
+	logger.Info("Directory sync completed successfully")
+}
+
+// Stop stops the scheduler
+func (s *Scheduler) Stop() {
+	log.Info("Stopping scheduler...")
+	close(s.stop)
+	s.cron.Stop()
+	log.Info("Scheduler stopped")
+}
+
+// checkAndExecute claims due jobs and executes them. Claiming flips each row
+// to executing under this worker's ID, so overlapping ticks or other replicas
+// never pick up the same job. Only as many jobs as the worker pool has free
+// slots for are claimed, highest priority first and taking turns between
+// requesters; the rest stay pending for a later tick.
+func (s *Scheduler) checkAndExecute() {
+	free, typeLimits := s.pool.Capacity()
+	if free <= 0 {
+		log.Debug("Worker pool is full, skipping claim")
+		return
+	}
+	reserved, urgent := s.pool.Reservation()
+
+	jobs, err := s.db.ClaimPendingJobs(s.workerID, s.lease, database.ClaimOptions{
+		Limit:          free,
+		TypeLimits:     typeLimits,
+		ReservedSlots:  reserved,
+		UrgentPriority: urgent,
+	})
+	if err != nil {
+		log.Errorf("Failed to claim pending jobs: %v", err)
+		return
+	}
+
+	if len(jobs) == 0 {
+		log.Debug("No pending jobs to execute")
+		return
+	}
+
+	log.Infof("Claimed %d pending jobs to execute", len(jobs))
+
+	now := time.Now()
+	for _, job := range jobs {
+		if openAt, reason := s.calendar.NextOpen(job.JobType, now); openAt.After(now) {
+			s.deferJob(job, openAt, reason)
+			continue
+		}
+		if !s.pool.Acquire(job.JobType, job.Priority) {
+			// Capacity was taken by an immediate execution since we checked.
+			log.WithField("id", job.ID).Debug("Worker pool filled up, returning job to pending")
+			s.finishJob(job, database.StatusPending, job.ErrorMessage)
+			continue
+		}
+		job := job
+		s.pool.Go(job.JobType, func() { s.executeJob(job) })
+	}
+}
+
+// executeJob executes a claimed job using the executor for its job type.
+func (s *Scheduler) executeJob(job database.ScheduledJob) {
+	logger := log.WithFields(log.Fields{
+		"id":       job.ID,
+		"job_type": job.JobType,
+		"worker":   s.workerID,
+	})
+
+	logger.Info("Starting job execution")
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	defer s.trackRunning(job.ID, cancel)()
+
+	stopHeartbeat := s.startHeartbeat(job.ID, s.db.RenewJobLease)
+	defer stopHeartbeat()
+
+	attempt := &database.JobAttempt{
+		JobID:         &job.ID,
+		AttemptNumber: job.RetryCount + 1,
+		WorkerID:      s.workerID,
+	}
+	if err := s.db.CreateJobAttempt(attempt); err != nil {
+		logger.Errorf("Failed to record job attempt: %v", err)
+		attempt = nil
+	}
+
+	executor := s.executorFor(job.JobType)
+	if executor == nil {
+		err := fmt.Errorf("no executor configured for job type: %s", job.JobType)
+		errMsg := err.Error()
+		logger.Error(errMsg)
+		s.finishAttempt(attempt, nil, 0, err)
+		s.failJob(job, database.FailureNoExecutor, errMsg, false)
+		return
+	}
+
+	if job.DryRun || s.cfg.Scheduler.DryRun {
+		s.dryRunJob(ctx, job, executor, attempt)
+		return
+	}
+
+	callbackToken, err := newCallbackToken()
+	if err != nil {
+		logger.Errorf("Failed to generate callback token: %v", err)
+	}
+
+	run := Execution{
+		Job:           job,
+		Attempt:       job.RetryCount + 1,
+		CallbackToken: callbackToken,
+		CallbackURL:   s.callbackURL(callbackToken),
+	}
+
+	start := time.Now()
+	result, err := executor.Execute(ctx, run)
+	if errors.Is(context.Cause(ctx), errJobCancelled) {
+		logger.Warn("Job was cancelled during execution")
+		s.finishCancelledExecution(job, executor, run, attempt, result, time.Since(start))
+		return
+	}
+	s.finishAttempt(attempt, result, time.Since(start), err)
+	if err != nil {
+		logger.Errorf("Failed to execute %s job: %v", job.JobType, err)
+		s.handleJobFailure(job, err.Error())
+		return
+	}
+
+	if result != nil && result.CallbackToken != "" {
+		s.awaitCallback(job, result.CallbackToken)
+		return
+	}
+
+	// Success
+	logger.Info("Job completed successfully")
+	s.finishJob(job, database.StatusCompleted, nil)
+}
+
+// dryRunJob rehearses a claimed job instead of executing it, through the
+// executor's DryRun if it has one and otherwise by validating the payload.
+// A successful rehearsal completes the job as completed_dry_run; a failed one
+// goes through retry handling like any other failure.
+func (s *Scheduler) dryRunJob(ctx context.Context, job database.ScheduledJob, executor Executor, attempt *database.JobAttempt) {
+	logger := log.WithField("id", job.ID)
+	logger.Info("Dry-running job; nothing will be changed")
+
+	run := Execution{Job: job, Attempt: job.RetryCount + 1, DryRun: true}
+
+	start := time.Now()
+	var result *Result
+	var err error
+	if dryRunner, ok := executor.(DryRunner); ok {
+		result, err = dryRunner.DryRun(ctx, run)
+	} else {
+		result, err = validatePayload(run)
+	}
+	if errors.Is(context.Cause(ctx), errJobCancelled) {
+		logger.Warn("Job was cancelled during dry run")
+		s.finishCancelledExecution(job, nil, run, attempt, result, time.Since(start))
+		return
+	}
+	s.finishAttempt(attempt, result, time.Since(start), err)
+	if err != nil {
+		logger.Errorf("Dry run of %s job failed: %v", job.JobType, err)
+		s.handleJobFailure(job, err.Error())
+		return
+	}
+
+	logger.Info("Dry run completed successfully")
+	s.finishJob(job, database.StatusCompletedDryRun, nil)
+}
+
+// deferJob hands a claimed job back until the execution calendar opens.
+func (s *Scheduler) deferJob(job database.ScheduledJob, until time.Time, reason string) {
+	logger := log.WithField("id", job.ID)
+	logger.Infof("Deferring job until %s: %s", until.In(s.location).Format(time.RFC3339), reason)
+
+	err := s.db.DeferJob(job.ID, s.workerID, until, reason)
+	if errors.Is(err, database.ErrCancelRequested) {
+		s.finishCancelRequested(job, false)
+	} else if errors.Is(err, database.ErrJobNotClaimed) {
+		logger.Warn("Lost claim on job before deferring it")
+	} else if err != nil {
+		logger.Errorf("Failed to defer job: %v", err)
+	}
+}
+
+// finishJob releases this worker's claim on a job and records its new status.
+func (s *Scheduler) finishJob(job database.ScheduledJob, status string, errorMsg *string) {
+	err := s.db.FinishJob(job.ID, s.workerID, status, errorMsg)
+	if errors.Is(err, database.ErrCancelRequested) {
+		s.finishCancelRequested(job, status == database.StatusCompleted)
+		return
+	}
+	if errors.Is(err, database.ErrJobNotClaimed) {
+		log.WithField("id", job.ID).Warnf("Lost claim on job before setting status %s", status)
+		return
+	}
+	if err != nil {
+		log.WithField("id", job.ID).Errorf("Failed to update status to %s: %v", status, err)
+	}
+}
+
+// handleJobFailure handles a failed job with retry logic. Retries are held
+// back with exponential backoff according to the job type's retry policy.
+func (s *Scheduler) handleJobFailure(job database.ScheduledJob, errorMsg string) {
+	logger := log.WithField("id", job.ID)
+	policy := s.cfg.Scheduler.RetryPolicyFor(job.JobType)
+
+	if job.RetryCount < policy.MaxRetries {
+		attempt := job.RetryCount + 1
+		delay := retryDelay(policy, attempt)
+		logger.Infof("Scheduling retry %d/%d in %s", attempt, policy.MaxRetries, delay.Round(time.Second))
+
+		err := s.db.RetryJob(job.ID, s.workerID, errorMsg, time.Now().Add(delay))
+		if errors.Is(err, database.ErrCancelRequested) {
+			s.finishCancelRequested(job, !(job.DryRun || s.cfg.Scheduler.DryRun))
+		} else if errors.Is(err, database.ErrJobNotClaimed) {
+			logger.Warn("Lost claim on job before scheduling retry")
+		} else if err != nil {
+			logger.Errorf("Failed to schedule retry: %v", err)
+		}
+	} else {
+		logger.Error("Max retries reached, marking as failed")
+		s.failJob(job, database.FailureRetriesExhausted, errorMsg, true)
+	}
+}
+
+// failJob marks a claimed job permanently failed. It then shows up in the
+// dead-letter queue until it is replayed. attempted is set if the job was
+// handed to its executor; a job cancelled meanwhile is then compensated.
+func (s *Scheduler) failJob(job database.ScheduledJob, reason string, errorMsg string, attempted bool) {
+	err := s.db.FailJob(job.ID, s.workerID, reason, errorMsg, attempted)
+	if errors.Is(err, database.ErrCancelRequested) {
+		s.finishCancelRequested(job, attempted && !(job.DryRun || s.cfg.Scheduler.DryRun))
+		return
+	}
+	if errors.Is(err, database.ErrJobNotClaimed) {
+		log.WithField("id", job.ID).Warn("Lost claim on job before marking it failed")
+		return
+	}
+	if err != nil {
+		log.WithField("id", job.ID).Errorf("Failed to mark job failed: %v", err)
+	}
+}
+
+// ErrJobNotFound is returned by ExecuteImmediately for an unknown job.
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobNotRunnable is returned by ExecuteImmediately for a job that may not
+// run now: it is not pending, waits on a dependency, its type is paused, or
+// the execution calendar is closed.
+var ErrJobNotRunnable = errors.New("job cannot run now")
+
+// ErrPoolFull is returned by ExecuteImmediately when no worker is free for
+// the job's type.
+var ErrPoolFull = errors.New("worker pool is at capacity")
+
+// ExecuteImmediately executes a job immediately, bypassing the schedule but
+// not dependencies, pauses or the execution calendar.
+func (s *Scheduler) ExecuteImmediately(jobID string) error {
+	id, err := uuid.Parse(jobID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid job ID", ErrJobNotFound)
+	}
+
+	job, err := s.db.GetJobByID(id)
+	if err != nil {
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+
+	if job == nil {
+		return ErrJobNotFound
+	}
+
+	if job.Status != database.StatusPending {
+		return fmt.Errorf("%w: job is %s, not pending", ErrJobNotRunnable, job.Status)
+	}
+
+	blocked, err := s.db.JobBlockedReason(id)
+	if err != nil {
+		return err
+	}
+	if blocked != "" {
+		return fmt.Errorf("%w: %s", ErrJobNotRunnable, blocked)
+	}
+
+	pause, err := s.db.GetPause(job.JobType)
+	if err != nil {
+		return fmt.Errorf("failed to check pause state: %w", err)
+	}
+	if pause != nil {
+		return fmt.Errorf("%w: %s jobs are paused by %s: %s", ErrJobNotRunnable, job.JobType, pause.PausedBy, pause.Reason)
+	}
+
+	now := time.Now()
+	if openAt, reason := s.calendar.NextOpen(job.JobType, now); openAt.After(now) {
+		return fmt.Errorf("%w: %s until %s", ErrJobNotRunnable, reason, openAt.In(s.location).Format(time.RFC3339))
+	}
+
+	if !s.pool.Acquire(job.JobType, job.Priority) {
+		return fmt.Errorf("%w for %s jobs", ErrPoolFull, job.JobType)
+	}
+
+	claimed, err := s.db.ClaimJob(id, s.workerID, s.lease)
+	if err != nil {
+		s.pool.Release(job.JobType)
+		return fmt.Errorf("failed to claim job: %w", err)
+	}
+	if claimed == nil {
+		s.pool.Release(job.JobType)
+		return fmt.Errorf("%w: job was claimed by another worker", ErrJobNotRunnable)
+	}
+
+	s.pool.Go(claimed.JobType, func() { s.executeJob(*claimed) })
+	return nil
+}
+
+// executeProvision is kept for backward compatibility.
+func (s *Scheduler) executeProvision(provision database.ScheduledProvision) {
+	logger := log.WithFields(log.Fields{
+		"id":       provision.ID,
+		"employee": provision.EmployeeData.FullName,
+		"email":    provision.EmployeeData.WorkEmail,
+	})
+
+	logger.Info("Starting provision execution (legacy path)")
+
+	if err := s.db.UpdateProvisionStatus(provision.ID, database.StatusExecuting, nil); err != nil {
+		logger.Errorf("Failed to update status to executing: %v", err)
+		return
+	}
+
+	payload := map[string]interface{}{
+		"employee":     provision.EmployeeData,
+		"applications": provision.Applications,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		errMsg := fmt.Sprintf("Failed to marshal payload: %v", err)
+		logger.Error(errMsg)
+		s.db.UpdateProvisionStatus(provision.ID, database.StatusFailed, &errMsg) //nolint:errcheck
+		return
+	}
+
+	resp, err := s.client.Post(
+		s.cfg.Provisioning.APIURL,
+		"application/json",
+		bytes.NewBuffer(jsonData),
+	)
+	if err != nil {
+		logger.Errorf("Failed to call provisioning API: %v", err)
+		s.handleProvisionFailure(provision, fmt.Sprintf("API call failed: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errMsg := fmt.Sprintf("API returned status %d", resp.StatusCode)
+		logger.Error(errMsg)
+		s.handleProvisionFailure(provision, errMsg)
+		return
+	}
+
+	logger.Info("Provision completed successfully")
+	if err := s.db.UpdateProvisionStatus(provision.ID, database.StatusCompleted, nil); err != nil {
+		logger.Errorf("Failed to update status to completed: %v", err)
+	}
+}
+
+// handleProvisionFailure is kept for backward compatibility.
+func (s *Scheduler) handleProvisionFailure(provision database.ScheduledProvision, errorMsg string) {
+	logger := log.WithField("id", provision.ID)
+
+	if err := s.db.IncrementRetryCount(provision.ID); err != nil {
+		logger.Errorf("Failed to increment retry count: %v", err)
+	}
+
+	if provision.RetryCount < s.cfg.Scheduler.MaxRetries {
+		logger.Infof("Scheduling retry %d/%d in %d seconds",
+			provision.RetryCount+1, s.cfg.Scheduler.MaxRetries, s.cfg.Scheduler.RetryDelay)
+
+		if err := s.db.UpdateProvisionStatus(provision.ID, database.StatusPending, &errorMsg); err != nil {
+			logger.Errorf("Failed to reset status for retry: %v", err)
+		}
+	} else {
+		logger.Error("Max retries reached, marking as failed")
+		if err := s.db.UpdateProvisionStatus(provision.ID, database.StatusFailed, &errorMsg); err != nil {
+			logger.Errorf("Failed to update status to failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package scheduler
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/config"
+)
+
+func TestSignerSign(t *testing.T) {
+	const (
+		body  = `{"a":1}`
+		jobID = "11111111-2222-3333-4444-555555555555"
+
+		// HMAC-SHA256 of "1760000000\nPOST\n/webhook/terminate?x=1\n<jobID>\n2\n\n\n\n{\"a\":1}".
+		newSig = "4c871756d98f793bdefbc7895bf8a65f7d3ca4e4ebc9c33be0f823a7e0c0700a"
+		oldSig = "9058534af2f2a17d4a452d7a2a3048d6e8250e7ffc032573a55f5464dcecfa9c"
+	)
+
+	tests := []struct {
+		name string
+		cfg  config.SigningConfig
+		want string
+	}{
+		{
+			name: "one key",
+			cfg:  config.SigningConfig{KeyID: "k2", Secret: "new-secret"},
+			want: "t=1760000000,kid=k2,v2=" + newSig,
+		},
+		{
+			name: "rotation signs with both keys, current first",
+			cfg:  config.SigningConfig{KeyID: "k2", Secret: "new-secret", PreviousKeyID: "k1", PreviousSecret: "old-secret"},
+			want: "t=1760000000,kid=k2,v2=" + newSig + ",kid=k1,v2=" + oldSig,
+		},
+		{
+			name: "previous key without a secret is ignored",
+			cfg:  config.SigningConfig{KeyID: "k2", Secret: "new-secret", PreviousKeyID: "k1"},
+			want: "t=1760000000,kid=k2,v2=" + newSig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := NewSigner(tt.cfg)
+			if signer == nil {
+				t.Fatal("NewSigner() = nil")
+			}
+			signer.now = func() time.Time { return time.Unix(1760000000, 0) }
+
+			req, err := http.NewRequest(http.MethodPost, "http://n8n.internal/webhook/terminate?x=1", bytes.NewReader([]byte(body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(JobIDHeader, jobID)
+			req.Header.Set(AttemptHeader, "2")
+
+			signer.Sign(req, []byte(body))
+			if got := req.Header.Get(SignatureHeader); got != tt.want {
+				t.Errorf("signature = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignerCoversRequest(t *testing.T) {
+	signer := NewSigner(config.SigningConfig{KeyID: "k", Secret: "secret"})
+	signer.now = func() time.Time { return time.Unix(1760000000, 0) }
+
+	sign := func(method, url string, headers map[string]string, body string) string {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		signer.Sign(req, []byte(body))
+		return req.Header.Get(SignatureHeader)
+	}
+
+	base := sign(http.MethodPost, "http://n8n/hook", map[string]string{JobIDHeader: "a", AttemptHeader: "1"}, "{}")
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		headers map[string]string
+		body    string
+	}{
+		{name: "method", method: http.MethodPut, url: "http://n8n/hook", headers: map[string]string{JobIDHeader: "a", AttemptHeader: "1"}, body: "{}"},
+		{name: "path", method: http.MethodPost, url: "http://n8n/other", headers: map[string]string{JobIDHeader: "a", AttemptHeader: "1"}, body: "{}"},
+		{name: "query", method: http.MethodPost, url: "http://n8n/hook?dry=1", headers: map[string]string{JobIDHeader: "a", AttemptHeader: "1"}, body: "{}"},
+		{name: "job ID", method: http.MethodPost, url: "http://n8n/hook", headers: map[string]string{JobIDHeader: "b", AttemptHeader: "1"}, body: "{}"},
+		{name: "attempt", method: http.MethodPost, url: "http://n8n/hook", headers: map[string]string{JobIDHeader: "a", AttemptHeader: "2"}, body: "{}"},
+		{name: "callback URL", method: http.MethodPost, url: "http://n8n/hook", headers: map[string]string{JobIDHeader: "a", AttemptHeader: "1", CallbackURLHeader: "http://evil"}, body: "{}"},
+		{name: "dry run", method: http.MethodPost, url: "http://n8n/hook", headers: map[string]string{JobIDHeader: "a", AttemptHeader: "1", DryRunHeader: "true"}, body: "{}"},
+		{name: "body", method: http.MethodPost, url: "http://n8n/hook", headers: map[string]string{JobIDHeader: "a", AttemptHeader: "1"}, body: `{"x":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sign(tt.method, tt.url, tt.headers, tt.body); got == base {
+				t.Errorf("changing the %s did not change the signature", tt.name)
+			}
+		})
+	}
+
+	if got := sign(http.MethodPost, "http://other-host/hook", map[string]string{JobIDHeader: "a", AttemptHeader: "1", "X-Unsigned": "x"}, "{}"); got != base {
+		t.Errorf("host and unsigned headers changed the signature: %q, want %q", got, base)
+	}
+}
+
+func TestNewSignerDisabled(t *testing.T) {
+	for _, cfg := range []config.SigningConfig{
+		{},
+		{KeyID: "k"},
+		{Secret: "secret"},
+	} {
+		if signer := NewSigner(cfg); signer != nil {
+			t.Errorf("NewSigner(%+v) = %+v, want nil", cfg, signer)
+		}
+	}
+
+	var signer *Signer
+	req, _ := http.NewRequest(http.MethodPost, "http://n8n/hook", nil)
+	signer.Sign(req, nil)
+	if got := req.Header.Get(SignatureHeader); got != "" {
+		t.Errorf("nil Signer set signature %q", got)
+	}
+}
@@ -0,0 +1,254 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"reflect"
+	"regexp"
+
+	"github.com/mfellsbbtv/oneclick-scheduler/pkg/database"
+)
+
+var (
+	// templatePlaceholder matches a {{param}} placeholder in a template
+	// payload string.
+	templatePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+	templateName  = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	templateParam = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+var templateParamTypes = map[string]bool{
+	database.TemplateParamString:  true,
+	database.TemplateParamEmail:   true,
+	database.TemplateParamInteger: true,
+	database.TemplateParamNumber:  true,
+	database.TemplateParamBoolean: true,
+	database.TemplateParamArray:   true,
+	database.TemplateParamObject:  true,
+}
+
+// omitted marks a value whose parameter was not given and has no default.
+// Object fields and array elements holding only such a placeholder are left
+// out of the rendered payload.
+type omitted struct{}
+
+// ValidateTemplate checks that a template can be saved: its name and job
+// type are valid, its payload is a JSON object, its parameters are well
+// formed, and every placeholder refers to a declared parameter that is used.
+func ValidateTemplate(t database.JobTemplate) error {
+	if !templateName.MatchString(t.Name) || len(t.Name) > 100 {
+		return fmt.Errorf("name must be letters, digits, '.', '_' or '-', at most 100 characters")
+	}
+	if !database.ValidJobTypes[t.JobType] {
+		return fmt.Errorf("invalid job_type")
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(t.Payload, &payload); err != nil {
+		return fmt.Errorf("payload must be JSON: %v", err)
+	}
+	if _, ok := payload.(map[string]interface{}); !ok {
+		return fmt.Errorf("payload must be a JSON object")
+	}
+
+	declared := map[string]bool{}
+	for _, param := range t.Parameters {
+		if !templateParam.MatchString(param.Name) {
+			return fmt.Errorf("parameter name %q must be letters, digits or '_'", param.Name)
+		}
+		if declared[param.Name] {
+			return fmt.Errorf("parameter %q is declared twice", param.Name)
+		}
+		declared[param.Name] = true
+
+		if !templateParamTypes[param.Type] {
+			return fmt.Errorf("parameter %q: unknown type %q", param.Name, param.Type)
+		}
+		for _, allowed := range param.Enum {
+			if err := checkParamValue(param, allowed, nil); err != nil {
+				return fmt.Errorf("parameter %q: enum value %v: %v", param.Name, allowed, err)
+			}
+		}
+		if param.Default != nil {
+			if err := checkParamValue(param, param.Default, param.Enum); err != nil {
+				return fmt.Errorf("parameter %q: default: %v", param.Name, err)
+			}
+		}
+	}
+
+	used := map[string]bool{}
+	walkStrings(payload, func(s string) {
+		for _, match := range templatePlaceholder.FindAllStringSubmatch(s, -1) {
+			used[match[1]] = true
+		}
+	})
+	for name := range used {
+		if !declared[name] {
+			return fmt.Errorf("payload uses undeclared parameter %q", name)
+		}
+	}
+	for _, param := range t.Parameters {
+		if !used[param.Name] {
+			return fmt.Errorf("parameter %q is not used in the payload", param.Name)
+		}
+	}
+	return nil
+}
+
+// RenderTemplate fills the placeholders of a template's payload with params.
+// Every param must be declared and match its type; required params must be
+// given, and defaults fill in the others. A string that is just a
+// placeholder takes the parameter's typed value, so {"google": "{{google}}"}
+// renders a boolean for a boolean parameter. Placeholders inside longer
+// strings are replaced by the value's text.
+func RenderTemplate(t database.JobTemplate, params map[string]interface{}) (database.JSONB, error) {
+	declared := map[string]bool{}
+	values := map[string]interface{}{}
+	for _, param := range t.Parameters {
+		declared[param.Name] = true
+
+		value, ok := params[param.Name]
+		switch {
+		case ok && value != nil:
+			if err := checkParamValue(param, value, param.Enum); err != nil {
+				return nil, fmt.Errorf("param %q: %v", param.Name, err)
+			}
+		case param.Default != nil:
+			value = param.Default
+		case param.Required:
+			return nil, fmt.Errorf("param %q is required", param.Name)
+		default:
+			value = omitted{}
+		}
+		values[param.Name] = value
+	}
+	for name := range params {
+		if !declared[name] {
+			return nil, fmt.Errorf("unknown param %q", name)
+		}
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(t.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("template payload is invalid: %w", err)
+	}
+
+	rendered, err := json.Marshal(renderValue(payload, values))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode rendered payload: %w", err)
+	}
+	return database.JSONB(rendered), nil
+}
+
+// renderValue substitutes placeholders throughout a decoded JSON value.
+func renderValue(v interface{}, values map[string]interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if match := templatePlaceholder.FindStringSubmatch(v); match != nil && match[0] == v {
+			return values[match[1]]
+		}
+		return templatePlaceholder.ReplaceAllStringFunc(v, func(placeholder string) string {
+			name := templatePlaceholder.FindStringSubmatch(placeholder)[1]
+			switch value := values[name].(type) {
+			case omitted:
+				return ""
+			case string:
+				return value
+			default:
+				text, _ := json.Marshal(value)
+				return string(text)
+			}
+		})
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			rendered := renderValue(child, values)
+			if _, skip := rendered.(omitted); !skip {
+				out[key] = rendered
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, child := range v {
+			rendered := renderValue(child, values)
+			if _, skip := rendered.(omitted); !skip {
+				out = append(out, rendered)
+			}
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// walkStrings calls fn for every string within a decoded JSON value.
+func walkStrings(v interface{}, fn func(string)) {
+	switch v := v.(type) {
+	case string:
+		fn(v)
+	case map[string]interface{}:
+		for _, child := range v {
+			walkStrings(child, fn)
+		}
+	case []interface{}:
+		for _, child := range v {
+			walkStrings(child, fn)
+		}
+	}
+}
+
+// checkParamValue checks that value has the parameter's type and, if enum
+// is not empty, is one of its values.
+func checkParamValue(param database.TemplateParam, value interface{}, enum []interface{}) error {
+	switch param.Type {
+	case database.TemplateParamString:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("must be a string")
+		}
+	case database.TemplateParamEmail:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be an email address")
+		}
+		if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+			return fmt.Errorf("must be an email address")
+		}
+	case database.TemplateParamInteger:
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			return fmt.Errorf("must be an integer")
+		}
+	case database.TemplateParamNumber:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("must be a number")
+		}
+	case database.TemplateParamBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("must be true or false")
+		}
+	case database.TemplateParamArray:
+		if _, ok := value.([]interface{}); !ok {
+			return fmt.Errorf("must be an array")
+		}
+	case database.TemplateParamObject:
+		if _, ok := value.(map[string]interface{}); !ok {
+			return fmt.Errorf("must be an object")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", param.Type)
+	}
+
+	if len(enum) == 0 {
+		return nil
+	}
+	for _, allowed := range enum {
+		if reflect.DeepEqual(value, allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %v", enum)
+}
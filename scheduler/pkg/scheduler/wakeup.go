@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+// listenerPingInterval is how often an idle wake-up connection is checked,
+// so a silently dropped connection is noticed and re-established.
+const listenerPingInterval = 90 * time.Second
+
+// startWakeups subscribes to schedule change notifications. Whenever a job
+// or change request is created, approved or rescheduled, and whenever the
+// next known schedule_time arrives, a check runs straight away instead of
+// on the next check_interval tick. Polling keeps running as the fallback.
+func (s *Scheduler) startWakeups() error {
+	listener, err := s.db.NewListener(func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+			log.Warnf("Wake-up listener lost its connection: %v", err)
+		case pq.ListenerEventReconnected:
+			log.Info("Wake-up listener reconnected")
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	go s.runWakeups(listener)
+	return nil
+}
+
+// runWakeups reacts to notifications and due-time timers until Stop.
+func (s *Scheduler) runWakeups(listener *pq.Listener) {
+	defer listener.Close()
+
+	// Fires immediately so the first timer is armed from the database.
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case n := <-listener.Notify:
+			if n == nil {
+				// Reconnected; anything sent meanwhile was lost.
+				log.Debug("Wake-up listener reconnected, checking for due work")
+			} else if id, ok := cancelledJobID(n.Extra); ok {
+				s.cancelRunning(id)
+				continue
+			} else {
+				log.WithField("payload", n.Extra).Debug("Woken by schedule change")
+			}
+			s.drainNotifications(listener)
+			s.wake(timer)
+		case <-timer.C:
+			s.wake(timer)
+		case <-ping.C:
+			if err := listener.Ping(); err != nil {
+				log.Warnf("Wake-up listener ping failed: %v", err)
+			}
+		}
+	}
+}
+
+// wake runs a check for due jobs and change requests, then re-arms timer for
+// the next schedule_time that is still in the future.
+func (s *Scheduler) wake(timer *time.Timer) {
+	s.checkAndExecute()
+	s.executeChangeRequests()
+
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+
+	next, err := s.db.NextDueTime()
+	if err != nil {
+		log.Errorf("Failed to find next due time, relying on polling: %v", err)
+		return
+	}
+	if next == nil {
+		return
+	}
+
+	log.Debugf("Next wake-up at %s", next.In(s.location).Format(time.RFC3339))
+	timer.Reset(time.Until(*next))
+}
+
+// cancelledJobID returns the job ID from a cancellation notification.
+func cancelledJobID(payload string) (uuid.UUID, bool) {
+	var event struct {
+		ID    uuid.UUID `json:"id"`
+		Event string    `json:"event"`
+	}
+	if err := json.Unmarshal([]byte(payload), &event); err != nil || event.Event != "cancel" {
+		return uuid.Nil, false
+	}
+	return event.ID, true
+}
+
+// drainNotifications discards notifications that queued up behind the one
+// being handled, so a burst of inserts triggers a single check. Cancellations
+// among them are still acted on.
+func (s *Scheduler) drainNotifications(listener *pq.Listener) {
+	for {
+		select {
+		case n := <-listener.Notify:
+			if n == nil {
+				continue
+			}
+			if id, ok := cancelledJobID(n.Extra); ok {
+				s.cancelRunning(id)
+			}
+		default:
+			return
+		}
+	}
+}